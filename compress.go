@@ -0,0 +1,86 @@
+package raw
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	gzipSuffix  = ".gz"
+	bzip2Suffix = ".bz2"
+)
+
+// Compression returns the compression suffix of a path, either ".gz", ".bz2" or an empty string.
+func Compression(path string) string {
+	for _, s := range []string{gzipSuffix, bzip2Suffix} {
+		if strings.HasSuffix(strings.ToLower(path), s) {
+			return s
+		}
+	}
+	return ""
+}
+
+// trimCompression removes any compression suffix from a path.
+func trimCompression(path string) string {
+	return path[:len(path)-len(Compression(path))]
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r readCloser) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if e := r.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// openFile opens a file for reading, decompressing it based on the path suffix.
+func openFile(path string) (io.ReadCloser, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch Compression(path) {
+	case gzipSuffix:
+		z, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return readCloser{Reader: z, closers: []io.Closer{f, z}}, nil
+	case bzip2Suffix:
+		return readCloser{Reader: bzip2.NewReader(f), closers: []io.Closer{f}}, nil
+	default:
+		return f, nil
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// compressWriter wraps a writer with any compression given by the path suffix, it must be closed
+// to flush the compressed stream. The output is deterministic so unchanged files compare equal.
+func compressWriter(path string, wr io.Writer) (io.WriteCloser, error) {
+	switch Compression(path) {
+	case gzipSuffix:
+		return gzip.NewWriter(wr), nil
+	case bzip2Suffix:
+		return nil, fmt.Errorf("%s: bzip2 compression is only supported for reading", path)
+	default:
+		return nopCloser{wr}, nil
+	}
+}
@@ -1,13 +1,41 @@
 package raw
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
-	"fmt"
 	"io"
-	"strconv"
+	"math"
 	"time"
 )
 
+func init() {
+	RegisterFormat(Format{
+		Name:       "csv",
+		Extensions: []string{".csv"},
+		New: func(dp int) ReadWriter {
+			return NewCsv(dp)
+		},
+		Sniff: sniffCsv,
+	})
+}
+
+// sniffCsv checks whether the first line is an epoch, source and value.
+func sniffCsv(head []byte) bool {
+	line, err := bufio.NewReader(bytes.NewReader(head)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	d, err := csv.NewReader(bytes.NewBufferString(line)).Read()
+	if err != nil || len(d) != csvLastIndex {
+		return false
+	}
+	if _, err := time.Parse(time.RFC3339Nano, d[csvEpochIndex]); err != nil {
+		return false
+	}
+	return true
+}
+
 const (
 	csvEpochIndex int = iota
 	csvSourceIndex
@@ -17,6 +45,20 @@ const (
 
 type Csv struct {
 	DecimalPlace *int
+
+	// optional file layout, the zero value gives epoch, source and value columns without a header
+	Dialect CsvDialect
+
+	// skip rows which can't be parsed rather than failing, they are available as rejects
+	Lenient bool
+
+	// optional per stream formatting, streams without a matching rule use the decimal places
+	Precision PrecisionRules
+}
+
+// precision returns the value formatting used for a source.
+func (c Csv) precision(source string) Precision {
+	return c.Precision.Select(source, c.DecimalPlace)
 }
 
 func NewCsv(dp int) *Csv {
@@ -26,56 +68,87 @@ func NewCsv(dp int) *Csv {
 }
 
 func (c Csv) Read(rd io.Reader) ([]Reading, error) {
-
 	var readings []Reading
-	data, err := csv.NewReader(rd).ReadAll()
-	if err != nil {
-		return nil, err
-	}
-	for n, d := range data {
-		if len(d) != csvLastIndex {
-			return nil, fmt.Errorf("line %d: invalid sample element length: %d", n, len(d))
-		}
 
-		var t time.Time
-		if err := t.UnmarshalText([]byte(d[csvEpochIndex])); err != nil {
-			return nil, fmt.Errorf("line %d: invalid sample time: %v", n, err)
+	dec := c.NewDecoder(rd)
+	for {
+		r, err := dec.Decode()
+		if err == io.EOF {
+			break
 		}
-
-		v, err := strconv.ParseFloat(d[csvValueIndex], 64)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: invalid sample float: %v", n, err)
+			return nil, err
 		}
-
-		readings = append(readings, Reading{
-			Source: d[csvSourceIndex],
-			Epoch:  t,
-			Value:  v,
-		})
+		readings = append(readings, r)
 	}
 
 	return readings, nil
 }
 
-func (c Csv) Write(wr io.Writer, rr []Reading) error {
-	var dp int
+// ReadRejects reads leniently, returning the valid readings together with any rows which could not be parsed.
+func (c Csv) ReadRejects(rd io.Reader) ([]Reading, []*ParseError, error) {
+	c.Lenient = true
+
+	var readings []Reading
 
-	switch {
-	case c.DecimalPlace != nil:
-		dp = *c.DecimalPlace
-	default:
-		dp = -1
+	dec := c.NewDecoder(rd)
+	for {
+		r, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, dec.Rejects(), err
+		}
+		readings = append(readings, r)
 	}
 
+	return readings, dec.Rejects(), nil
+}
+
+func (c Csv) Write(wr io.Writer, rr []Reading) error {
+	columns := c.Dialect.columns()
+
+	// avoid matching the precision rules for every reading
+	precisions := make(map[string]Precision)
+
 	data := [][]string{}
+	if c.Dialect.Header {
+		data = append(data, columns)
+	}
 	for _, r := range rr {
-		b, err := r.Epoch.MarshalText()
-		if err != nil {
-			return err
+		var line []string
+		for _, col := range columns {
+			switch col {
+			case CsvTime:
+				s, err := c.Dialect.formatTime(r.Epoch)
+				if err != nil {
+					return err
+				}
+				line = append(line, s)
+			case CsvSource:
+				line = append(line, r.Source)
+			case CsvValue:
+				if math.IsNaN(r.Value) && c.Dialect.Missing != "" {
+					line = append(line, c.Dialect.Missing)
+					continue
+				}
+				p, ok := precisions[r.Source]
+				if !ok {
+					p = c.precision(r.Source)
+					precisions[r.Source] = p
+				}
+				line = append(line, p.Format(r.Value))
+			default:
+				line = append(line, "")
+			}
 		}
-		data = append(data, []string{string(b), r.Source, strconv.FormatFloat(r.Value, 'f', dp, 64)})
+		data = append(data, line)
 	}
-	if err := csv.NewWriter(wr).WriteAll(data); err != nil {
+
+	w := csv.NewWriter(wr)
+	w.Comma = c.Dialect.separator()
+	if err := w.WriteAll(data); err != nil {
 		return err
 	}
 
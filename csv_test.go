@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"math"
 	"testing"
+	"time"
 )
 
 func TestCsv_File(t *testing.T) {
@@ -70,3 +71,112 @@ func TestCsv_File(t *testing.T) {
 
 	}
 }
+
+func TestCsv_Dialect(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 250000000, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LFZ", at, -41221.5},
+		{"NZ_APIM_50_LFZ", at.Add(time.Second), math.NaN()},
+	}
+
+	var tests = []struct {
+		d CsvDialect
+		s string
+	}{
+		{
+			CsvDialect{},
+			"2016-08-02T04:00:00.25Z,NZ_APIM_50_LFZ,-41221.5\n2016-08-02T04:00:01.25Z,NZ_APIM_50_LFZ,NaN\n",
+		},
+		{
+			CsvDialect{Header: true, Columns: []string{CsvSource, CsvTime, "flag", CsvValue}, TimeFormat: CsvUnix, Separator: ';', Missing: "NA"},
+			"source;time;flag;value\nNZ_APIM_50_LFZ;1470110400.25;;-41221.5\nNZ_APIM_50_LFZ;1470110401.25;;NA\n",
+		},
+		{
+			CsvDialect{Columns: []string{CsvTime, CsvValue}, Source: "NZ_APIM_50_LFZ", TimeFormat: CsvUnixMs, Missing: "-"},
+			"1470110400250,-41221.5\n1470110401250,-\n",
+		},
+		{
+			CsvDialect{Columns: []string{CsvTime, CsvValue}, Source: "NZ_APIM_50_LFZ", TimeFormat: CsvExcel, Separator: '\t', Missing: ""},
+			"42584.16666956018\t-41221.5\n42584.16668113426\tNaN\n",
+		},
+		{
+			CsvDialect{Header: true, Columns: []string{CsvTime, CsvSource, CsvValue}, TimeFormat: "2006/01/02 15:04:05.000", Missing: "99999"},
+			"time,source,value\n2016/08/02 04:00:00.250,NZ_APIM_50_LFZ,-41221.5\n2016/08/02 04:00:01.250,NZ_APIM_50_LFZ,99999\n",
+		},
+	}
+
+	for _, x := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, Csv{Dialect: x.d}, readings); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != x.s {
+			t.Errorf("invalid csv output, expected:\n%q\nfound:\n%q", x.s, buf.String())
+		}
+
+		r, err := Read(bytes.NewBufferString(x.s), Csv{Dialect: x.d})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r) != len(readings) {
+			t.Fatalf("invalid number of readings, expected %d found %d", len(readings), len(r))
+		}
+		for i := range readings {
+			if r[i].Source != readings[i].Source || !r[i].Epoch.Equal(readings[i].Epoch) {
+				t.Errorf("invalid reading %d, expected %s found %s", i, readings[i], r[i])
+			}
+			if v := readings[i].Value; (math.IsNaN(v) && !math.IsNaN(r[i].Value)) || (!math.IsNaN(v) && v != r[i].Value) {
+				t.Errorf("invalid reading value %d, expected %g found %g", i, v, r[i].Value)
+			}
+		}
+	}
+}
+
+func TestCsv_Comments(t *testing.T) {
+	s := "# exported readings\ntime,value\n# first sample\n2016-08-02T04:00:00Z,1.5\n"
+
+	r, err := Read(bytes.NewBufferString(s), Csv{Dialect: CsvDialect{Header: true, Comment: '#', Source: "NZ_APIM_50_LFZ"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 || r[0].Source != "NZ_APIM_50_LFZ" || r[0].Value != 1.5 {
+		t.Errorf("invalid readings: %v", r)
+	}
+}
+
+func TestCsv_ParseError(t *testing.T) {
+	s := "2016-08-02T04:00:00Z,A,1\n2016-08-02T04:00:01Z,A,x\n2016-08-02T04:00:02Z,A\n2016-08-02T04:00:03Z,A,4\n"
+
+	_, err := Read(bytes.NewBufferString(s), Csv{})
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected a parse error, found: %v", err)
+	}
+	if perr.Line != 2 || perr.Column != 24 {
+		t.Errorf("invalid parse error position, expected line 2 column 24, found line %d column %d", perr.Line, perr.Column)
+	}
+
+	r, rejects, err := Csv{}.ReadRejects(bytes.NewBufferString(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 {
+		t.Errorf("invalid number of readings, expected 2 found %d", len(r))
+	}
+	if len(rejects) != 2 || rejects[0].Line != 2 || rejects[1].Line != 3 {
+		t.Errorf("invalid rejects: %v", rejects)
+	}
+
+	dec := Csv{}.NewDecoder(bytes.NewBufferString(s))
+	dec.File = "test.csv"
+	for {
+		if _, err = dec.Decode(); err != nil {
+			break
+		}
+	}
+	if err == nil || err.Error() != "test.csv: line 2, column 24: invalid sample float: strconv.ParseFloat: parsing \"x\": invalid syntax" {
+		t.Errorf("invalid decoder error: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package raw
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// ParseError records where a row could not be parsed, the line and column are one based.
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Record []string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	if e.File != "" {
+		return e.File + ": " + msg
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// CsvDecoder reads csv rows one reading at a time.
+type CsvDecoder struct {
+	// optional file name used in parse errors
+	File string
+
+	csv     Csv
+	r       *csv.Reader
+	columns []string
+	header  bool
+	rejects []*ParseError
+}
+
+func (c Csv) NewDecoder(rd io.Reader) *CsvDecoder {
+	r := csv.NewReader(rd)
+	r.Comma = c.Dialect.separator()
+	r.Comment = c.Dialect.Comment
+	r.FieldsPerRecord = -1
+
+	return &CsvDecoder{
+		csv:     c,
+		r:       r,
+		columns: c.Dialect.columns(),
+		header:  c.Dialect.Header,
+	}
+}
+
+// Rejects returns the rows skipped in lenient mode.
+func (d *CsvDecoder) Rejects() []*ParseError {
+	return d.rejects
+}
+
+// Decode returns the next reading, or io.EOF once the input is exhausted. Rows which can't be
+// parsed return a *ParseError unless the decoder is lenient.
+func (d *CsvDecoder) Decode() (Reading, error) {
+	for {
+		r, err := d.next()
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			if perr.File == "" {
+				perr.File = d.File
+			}
+			if d.csv.Lenient {
+				d.rejects = append(d.rejects, perr)
+				continue
+			}
+		}
+		return r, err
+	}
+}
+
+func (d *CsvDecoder) fail(record []string, field int, err error) *ParseError {
+	line, column := d.r.FieldPos(field)
+	return &ParseError{
+		Line:   line,
+		Column: column,
+		Record: record,
+		Err:    err,
+	}
+}
+
+func (d *CsvDecoder) next() (Reading, error) {
+	for {
+		rec, err := d.r.Read()
+		if err != nil {
+			var cerr *csv.ParseError
+			if errors.As(err, &cerr) {
+				return Reading{}, &ParseError{Line: cerr.Line, Column: cerr.Column, Record: rec, Err: cerr.Err}
+			}
+			return Reading{}, err
+		}
+
+		if d.header {
+			// an unspecified column order can be taken from the header
+			if len(d.csv.Dialect.Columns) == 0 {
+				if cols, err := csvColumns(rec); err == nil {
+					d.columns = cols
+				}
+			}
+			d.header = false
+			continue
+		}
+
+		if len(rec) != len(d.columns) {
+			return Reading{}, d.fail(rec, 0, fmt.Errorf("invalid sample element length: %d", len(rec)))
+		}
+
+		reading := Reading{
+			Source: d.csv.Dialect.Source,
+		}
+		for i, col := range d.columns {
+			switch col {
+			case CsvTime:
+				t, err := d.csv.Dialect.parseTime(rec[i])
+				if err != nil {
+					return Reading{}, d.fail(rec, i, fmt.Errorf("invalid sample time: %v", err))
+				}
+				reading.Epoch = t
+			case CsvSource:
+				reading.Source = rec[i]
+			case CsvValue:
+				if d.csv.Dialect.Missing != "" && rec[i] == d.csv.Dialect.Missing {
+					reading.Value = math.NaN()
+					continue
+				}
+				v, err := strconv.ParseFloat(rec[i], 64)
+				if err != nil {
+					return Reading{}, d.fail(rec, i, fmt.Errorf("invalid sample float: %v", err))
+				}
+				reading.Value = v
+			}
+		}
+
+		return reading, nil
+	}
+}
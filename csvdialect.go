@@ -0,0 +1,160 @@
+package raw
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Csv column names, any other column is ignored on reading and left empty on writing.
+const (
+	CsvTime   = "time"
+	CsvSource = "source"
+	CsvValue  = "value"
+)
+
+// Csv time formats, any other value is used as a time layout.
+const (
+	CsvRFC3339 = "rfc3339"
+	CsvUnix    = "unix"
+	CsvUnixMs  = "unixms"
+	CsvExcel   = "excel"
+)
+
+// excelEpoch is day zero for spreadsheet serial dates.
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// CsvDialect describes the layout of a csv file, it is used for both reading and writing.
+type CsvDialect struct {
+	// write, and skip on reading, a header row of column names
+	Header bool
+
+	// column order, the default is time, source and value
+	Columns []string
+
+	// source used when there is no source column
+	Source string
+
+	// one of rfc3339 (the default), unix, unixms, excel, or a time layout
+	TimeFormat string
+
+	// field separator, the default is a comma
+	Separator rune
+
+	// lines starting with this character are skipped on reading
+	Comment rune
+
+	// token used for missing values, these are read as NaN
+	Missing string
+}
+
+// ParseCsvColumns splits a comma separated list of column names, "epoch" is accepted for time.
+func ParseCsvColumns(s string) ([]string, error) {
+	return csvColumns(strings.Split(s, ","))
+}
+
+func csvColumns(names []string) ([]string, error) {
+	var columns []string
+	var found bool
+	for _, n := range names {
+		switch c := strings.ToLower(strings.TrimSpace(n)); c {
+		case "epoch", CsvTime:
+			columns, found = append(columns, CsvTime), true
+		default:
+			columns = append(columns, c)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("csv columns must include a time: %s", strings.Join(names, ","))
+	}
+	return columns, nil
+}
+
+func (d CsvDialect) columns() []string {
+	if len(d.Columns) > 0 {
+		return d.Columns
+	}
+	return []string{CsvTime, CsvSource, CsvValue}
+}
+
+func (d CsvDialect) separator() rune {
+	if d.Separator != 0 {
+		return d.Separator
+	}
+	return ','
+}
+
+func (d CsvDialect) parseTime(s string) (time.Time, error) {
+	switch strings.ToLower(d.TimeFormat) {
+	case "", CsvRFC3339:
+		var t time.Time
+		err := t.UnmarshalText([]byte(s))
+		return t, err
+	case CsvUnix, CsvUnixMs:
+		unit := time.Second
+		if strings.ToLower(d.TimeFormat) == CsvUnixMs {
+			unit = time.Millisecond
+		}
+		whole, frac := s, ""
+		if i := strings.Index(s, "."); i >= 0 {
+			whole, frac = s[:i], s[i:]
+		}
+		n, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		t := time.Unix(0, 0).UTC().Add(time.Duration(n) * unit)
+		if frac != "" {
+			f, err := strconv.ParseFloat("0"+frac, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if strings.HasPrefix(whole, "-") {
+				f = -f
+			}
+			t = t.Add(time.Duration(math.Round(f * float64(unit))))
+		}
+		return t, nil
+	case CsvExcel:
+		days, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// spreadsheets hold times to the millisecond
+		return excelEpoch.Add(time.Duration(math.Round(days*86400000)) * time.Millisecond), nil
+	default:
+		return time.Parse(d.TimeFormat, s)
+	}
+}
+
+func (d CsvDialect) formatTime(t time.Time) (string, error) {
+	switch strings.ToLower(d.TimeFormat) {
+	case "", CsvRFC3339:
+		b, err := t.MarshalText()
+		return string(b), err
+	case CsvUnix:
+		return formatUnix(t.UnixNano(), int64(time.Second), 9), nil
+	case CsvUnixMs:
+		return formatUnix(t.UnixNano(), int64(time.Millisecond), 6), nil
+	case CsvExcel:
+		ms := t.Sub(excelEpoch).Milliseconds()
+		return strconv.FormatFloat(float64(ms)/86400000.0, 'f', -1, 64), nil
+	default:
+		return t.UTC().Format(d.TimeFormat), nil
+	}
+}
+
+// formatUnix writes an integer count of units with only as many fractional digits as needed.
+func formatUnix(nanos, unit int64, digits int) string {
+	sign := ""
+	if nanos < 0 {
+		sign, nanos = "-", -nanos
+	}
+	s := sign + strconv.FormatInt(nanos/unit, 10)
+	if frac := nanos % unit; frac != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%0*d", digits, frac), "0")
+	}
+	return s
+}
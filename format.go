@@ -0,0 +1,160 @@
+package raw
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Format describes a reading codec which can be selected by name or detected from a file.
+type Format struct {
+	// Name used to select the format, e.g. "csv"
+	Name string
+
+	// File extensions, including the leading dot, the first is used for new files
+	Extensions []string
+
+	// New returns a codec using the given decimal places, negative values use the fewest needed.
+	New func(dp int) ReadWriter
+
+	// Sniff reports whether the start of a file looks like this format.
+	Sniff func(head []byte) bool
+
+	// ReadOnly formats can only be used for input.
+	ReadOnly bool
+}
+
+// Extension returns the preferred file extension for the format.
+func (f Format) Extension() string {
+	if len(f.Extensions) > 0 {
+		return f.Extensions[0]
+	}
+	return ""
+}
+
+var formats = struct {
+	sync.RWMutex
+	list []Format
+}{}
+
+// RegisterFormat makes a codec available by name and extension, it panics if the name is already in use.
+func RegisterFormat(f Format) {
+	formats.Lock()
+	defer formats.Unlock()
+
+	if f.Name == "" || f.New == nil {
+		panic("raw: invalid format registration")
+	}
+	for _, v := range formats.list {
+		if v.Name == f.Name {
+			panic("raw: format registered twice: " + f.Name)
+		}
+	}
+	formats.list = append(formats.list, f)
+}
+
+// Formats returns the names of all registered formats.
+func Formats() []string {
+	formats.RLock()
+	defer formats.RUnlock()
+
+	var names []string
+	for _, f := range formats.list {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// LookupFormat finds a registered format by name.
+func LookupFormat(name string) (Format, error) {
+	formats.RLock()
+	for _, f := range formats.list {
+		if strings.EqualFold(f.Name, name) {
+			formats.RUnlock()
+			return f, nil
+		}
+	}
+	formats.RUnlock()
+
+	return Format{}, fmt.Errorf("unknown format %q, expected one of: %s", name, strings.Join(Formats(), ", "))
+}
+
+// OutputFormat finds a registered format by name which can be written.
+func OutputFormat(name string) (Format, error) {
+	f, err := LookupFormat(name)
+	if err != nil {
+		return Format{}, err
+	}
+	if f.ReadOnly {
+		return Format{}, fmt.Errorf("format %q can only be read", f.Name)
+	}
+	return f, nil
+}
+
+// DetectFormat chooses a format from the file extension, falling back to checking the start of the
+// file contents if the extension is unknown or shared by several formats.
+func DetectFormat(path string, head []byte) (Format, error) {
+	formats.RLock()
+	defer formats.RUnlock()
+
+	sniff := func(list []Format) (Format, bool) {
+		for _, f := range list {
+			if f.Sniff != nil && len(head) > 0 && f.Sniff(head) {
+				return f, true
+			}
+		}
+		return Format{}, false
+	}
+
+	var candidates []Format
+	if ext := strings.ToLower(filepath.Ext(path)); ext != "" {
+		for _, f := range formats.list {
+			for _, e := range f.Extensions {
+				if ext == e {
+					candidates = append(candidates, f)
+					break
+				}
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		if f, ok := sniff(formats.list); ok {
+			return f, nil
+		}
+	case 1:
+		return candidates[0], nil
+	default:
+		if f, ok := sniff(candidates); ok {
+			return f, nil
+		}
+		return candidates[0], nil
+	}
+
+	return Format{}, fmt.Errorf("unable to detect format: %s", path)
+}
+
+// sniffSize is how much of a file is checked when detecting its format.
+const sniffSize = 1024
+
+// detectFile reads the start of a file to detect its format, ignoring any compression.
+func detectFile(path string) (Format, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return Format{}, err
+	}
+	defer f.Close()
+
+	head, err := bufio.NewReaderSize(f, sniffSize).Peek(sniffSize)
+	if err != nil && len(head) == 0 {
+		return DetectFormat(trimCompression(path), nil)
+	}
+
+	return DetectFormat(trimCompression(path), head)
+}
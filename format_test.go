@@ -0,0 +1,80 @@
+package raw
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestFormat_Detect(t *testing.T) {
+
+	var tests = []struct {
+		f string
+		n string
+	}{
+		{"testdata/2016.215.04.NZ_APIM_50_LFZ.csv", "csv"},
+		{"testdata/NZ.APIM.50.LFZ.D.2016.215", "mseed"},
+		{"example.min", "iaga2002"},
+	}
+
+	for _, x := range tests {
+		head, _ := ioutil.ReadFile(x.f)
+
+		f, err := DetectFormat(x.f, head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name != x.n {
+			t.Errorf("invalid format detected for %s, expected %s found %s", x.f, x.n, f.Name)
+		}
+	}
+}
+
+func TestFormat_Sniff(t *testing.T) {
+
+	var tests = []struct {
+		f string
+		n string
+	}{
+		{"testdata/2016.215.04.NZ_APIM_50_LFZ.csv", "csv"},
+		{"testdata/NZ.APIM.50.LFZ.D.2016.215", "mseed"},
+	}
+
+	for _, x := range tests {
+		head, err := ioutil.ReadFile(x.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := DetectFormat("unknown", head[:sniffSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name != x.n {
+			t.Errorf("invalid format sniffed for %s, expected %s found %s", x.f, x.n, f.Name)
+		}
+	}
+}
+
+func TestFormat_Lookup(t *testing.T) {
+	if _, err := OutputFormat("csv"); err != nil {
+		t.Error(err)
+	}
+	if _, err := OutputFormat("mseed"); err != nil {
+		t.Error(err)
+	}
+
+	// formats may be registered for input only
+	if _, err := LookupFormat("test-readonly"); err != nil {
+		RegisterFormat(Format{
+			Name:     "test-readonly",
+			New:      func(int) ReadWriter { return NewMSeed(0.0, 1.0) },
+			ReadOnly: true,
+		})
+	}
+	if _, err := OutputFormat("test-readonly"); err == nil {
+		t.Error("expected an error writing a read only format")
+	}
+	if _, err := LookupFormat("unknown"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
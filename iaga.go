@@ -0,0 +1,265 @@
+package raw
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	iagaTimeFormat = "2006-01-02 15:04:05.000"
+
+	// values used for missing and unrecorded samples
+	iagaMissing    = 99999.0
+	iagaUnrecorded = 88888.0
+
+	// header lines are padded to a fixed width and terminated with a bar
+	iagaLineWidth = 69
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:       "iaga2002",
+		Extensions: []string{".iaga", ".min", ".sec"},
+		New: func(dp int) ReadWriter {
+			return NewIaga(dp)
+		},
+		Sniff: func(head []byte) bool {
+			return bytes.HasPrefix(bytes.TrimLeft(head, " "), []byte("Format")) && bytes.Contains(head, []byte("IAGA-2002"))
+		},
+	})
+}
+
+// Iaga reads and writes single station IAGA-2002 exchange files, each reading source is mapped
+// to one of the four element columns using its channel orientation.
+type Iaga struct {
+	DecimalPlace *int
+}
+
+func NewIaga(dp int) *Iaga {
+	return &Iaga{
+		DecimalPlace: &dp,
+	}
+}
+
+func iagaHeader(label, value string) string {
+	return fmt.Sprintf("%-*s|", iagaLineWidth, fmt.Sprintf(" %-22s %s", label, value))
+}
+
+func iagaComment(comment string) string {
+	return fmt.Sprintf("%-*s|", iagaLineWidth, " # "+comment)
+}
+
+// iagaCode returns the station component of a source name.
+func iagaCode(source string) string {
+	if parts := strings.Split(source, "_"); len(parts) > 1 {
+		return strings.ToUpper(parts[1])
+	}
+	return strings.ToUpper(source)
+}
+
+// iagaElement returns the orientation code of a source name.
+func iagaElement(source string) string {
+	parts := strings.Split(source, "_")
+	if c := parts[len(parts)-1]; c != "" {
+		return strings.ToUpper(c[len(c)-1:])
+	}
+	return ""
+}
+
+func (c Iaga) Write(wr io.Writer, rr []Reading) error {
+	dp := 2
+	if c.DecimalPlace != nil && *c.DecimalPlace >= 0 {
+		dp = *c.DecimalPlace
+	}
+
+	// find the station and element columns
+	var code string
+	var sources []string
+	values := make(map[time.Time]map[string]float64)
+	for _, r := range rr {
+		switch s := iagaCode(r.Source); {
+		case code == "":
+			code = s
+		case code != s:
+			return fmt.Errorf("iaga2002 files hold a single station, found %s and %s", code, s)
+		}
+		v, ok := values[r.Epoch]
+		if !ok {
+			v = make(map[string]float64)
+			values[r.Epoch] = v
+		}
+		if _, ok := v[r.Source]; !ok {
+			if n := sort.SearchStrings(sources, r.Source); n >= len(sources) || sources[n] != r.Source {
+				sources = append(sources, r.Source)
+				sort.Strings(sources)
+			}
+		}
+		v[r.Source] = r.Value
+	}
+	if len(sources) > 4 {
+		return fmt.Errorf("iaga2002 files hold at most four elements, found %d", len(sources))
+	}
+
+	var reported string
+	elements := make(map[string]string)
+	for _, s := range sources {
+		e := iagaElement(s)
+		if e == "" || strings.Contains(reported, e) {
+			return fmt.Errorf("unable to find a unique iaga2002 element for %s", s)
+		}
+		elements[s], reported = e, reported+e
+	}
+	// fill any unused columns
+	for _, e := range "XYZFHDEG" {
+		if len(reported) >= 4 {
+			break
+		}
+		if !strings.ContainsRune(reported, e) {
+			reported += string(e)
+		}
+	}
+
+	var lines []string
+	lines = append(lines, iagaHeader("Format", "IAGA-2002"))
+	lines = append(lines, iagaHeader("IAGA Code", code))
+	lines = append(lines, iagaHeader("Reported", reported))
+	for _, s := range sources {
+		lines = append(lines, iagaComment("Source "+code+elements[s]+" "+s))
+	}
+
+	columns := "DATE       TIME         DOY     "
+	for _, e := range reported {
+		columns += fmt.Sprintf("%-10s", code+string(e))
+	}
+	lines = append(lines, fmt.Sprintf("%-*s|", iagaLineWidth, strings.TrimRight(columns, " ")))
+
+	var epochs []time.Time
+	for t := range values {
+		epochs = append(epochs, t)
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i].Before(epochs[j]) })
+
+	for _, t := range epochs {
+		line := t.UTC().Format(iagaTimeFormat) + fmt.Sprintf(" %03d   ", t.UTC().YearDay())
+		for n := range reported {
+			v := iagaUnrecorded
+			if n < len(sources) {
+				if x, ok := values[t][sources[n]]; ok {
+					v = x
+				} else {
+					v = iagaMissing
+				}
+			}
+			line += fmt.Sprintf(" %9s", strconv.FormatFloat(v, 'f', dp, 64))
+		}
+		lines = append(lines, line)
+	}
+
+	w := bufio.NewWriter(wr)
+	for _, l := range lines {
+		if _, err := w.WriteString(l + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func (c Iaga) Read(rd io.Reader) ([]Reading, error) {
+	readings, _, err := c.read(rd, false)
+	return readings, err
+}
+
+// ReadRejects reads leniently, returning the valid readings together with any data lines which
+// could not be parsed, a malformed header is still an error.
+func (c Iaga) ReadRejects(rd io.Reader) ([]Reading, []*ParseError, error) {
+	return c.read(rd, true)
+}
+
+func (c Iaga) read(rd io.Reader, lenient bool) ([]Reading, []*ParseError, error) {
+	var readings []Reading
+	var rejects []*ParseError
+
+	var columns []string
+	sources := make(map[string]string)
+
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+
+		// malformed data lines either stop the read or are collected
+		fail := func(column int, err error) error {
+			perr := &ParseError{Line: n, Column: column, Record: []string{line}, Err: err}
+			if !lenient {
+				return perr
+			}
+			rejects = append(rejects, perr)
+			return nil
+		}
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			continue
+		case columns == nil && strings.HasPrefix(line, "DATE"):
+			columns = strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), "|"))
+			if len(columns) < 4 {
+				return nil, nil, &ParseError{Line: n, Column: 1, Record: []string{line}, Err: fmt.Errorf("invalid iaga2002 column header")}
+			}
+			columns = columns[3:]
+			continue
+		case columns == nil:
+			// header or comment, only the source mapping comments are used
+			if f := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), "|")); len(f) == 4 && f[0] == "#" && f[1] == "Source" {
+				sources[f[2]] = f[3]
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != len(columns)+3 {
+			if err := fail(1, fmt.Errorf("invalid iaga2002 element count: %d", len(fields))); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		t, err := time.Parse(iagaTimeFormat, fields[0]+" "+fields[1])
+		if err != nil {
+			if err := fail(1, fmt.Errorf("invalid sample time: %v", err)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		for i, f := range fields[3:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				if err := fail(strings.Index(line, f)+1, fmt.Errorf("invalid sample float: %v", err)); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			if v == iagaMissing || v == iagaUnrecorded {
+				continue
+			}
+			source, ok := sources[columns[i]]
+			if !ok {
+				source = columns[i]
+			}
+			readings = append(readings, Reading{
+				Source: source,
+				Epoch:  t,
+				Value:  v,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return readings, rejects, nil
+}
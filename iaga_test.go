@@ -0,0 +1,93 @@
+package raw
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIaga_RoundTrip(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LFX", at, 18076.6},
+		{"NZ_APIM_50_LFZ", at, -41221.0},
+		{"NZ_APIM_50_LFX", at.Add(time.Minute), 18076.7},
+		{"NZ_APIM_50_LFZ", at.Add(time.Minute), -41220.5},
+		{"NZ_APIM_50_LFZ", at.Add(2 * time.Minute), -41219.25},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, NewIaga(-1), readings); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := DetectFormat("unknown", buf.Bytes()); err != nil || f.Name != "iaga2002" {
+		t.Errorf("unable to sniff iaga2002 output: %v", err)
+	}
+
+	r, err := Read(bytes.NewBuffer(buf.Bytes()), Iaga{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Sort(readings)
+	if r = Sort(r); len(r) != len(expected) {
+		t.Fatalf("invalid number of readings, expected %d found %d", len(expected), len(r))
+	}
+	for i := range expected {
+		if !r[i].Equal(expected[i]) || r[i].Value != expected[i].Value {
+			t.Errorf("invalid reading %d, expected %s found %s", i, expected[i], r[i])
+		}
+	}
+}
+
+func TestIaga_Stations(t *testing.T) {
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Iaga{}, []Reading{{"NZ_APIM_50_LFZ", at, 1.0}, {"NZ_EYWM_50_LFZ", at, 2.0}}); err == nil {
+		t.Error("expected an error writing several stations")
+	}
+}
+
+func TestIaga_Rejects(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LFZ", at, -41221.0},
+		{"NZ_APIM_50_LFZ", at.Add(time.Minute), -41220.5},
+		{"NZ_APIM_50_LFZ", at.Add(2 * time.Minute), -41219.25},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, NewIaga(-1), readings); err != nil {
+		t.Fatal(err)
+	}
+
+	// spoil the time of the second sample
+	lines := strings.Split(buf.String(), "\n")
+	var line int
+	for i, l := range lines {
+		if strings.HasPrefix(l, "2016-08-02 04:01") {
+			lines[i], line = strings.Replace(l, "2016-08-02", "2016-13-02", 1), i+1
+		}
+	}
+	s := strings.Join(lines, "\n")
+
+	_, err := Read(bytes.NewBufferString(s), Iaga{})
+	if perr, ok := err.(*ParseError); !ok || perr.Line != line {
+		t.Fatalf("expected a parse error on line %d, found %v", line, err)
+	}
+
+	r, rejects, err := Iaga{}.ReadRejects(bytes.NewBufferString(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || len(rejects) != 1 {
+		t.Errorf("invalid lenient read, found %d readings and %d rejects", len(r), len(rejects))
+	}
+}
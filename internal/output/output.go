@@ -0,0 +1,149 @@
+// Package output sets up the file format and names used by the commands which store readings.
+package output
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+// DefaultTemplate stores hourly files per stream, its extension follows the output format.
+const DefaultTemplate = "{{Year .Epoch}}/{{Year .Epoch}}.{{Doy .Epoch}}/{{Year .Epoch}}.{{Doy .Epoch}}.{{Hour .Epoch}}.{{.Source}}.csv"
+
+// Flags holds the command line options describing how readings are stored.
+type Flags struct {
+	Template     string
+	DecimalPlace int
+	Format       string
+	Align        time.Duration
+	Precision    string
+	Gzip         bool
+	Zone         string
+	Inventory    string
+}
+
+// Register adds the output options to a flag set.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Template, "template", DefaultTemplate, "file name template")
+	fs.IntVar(&f.DecimalPlace, "dp", -1, "decimal places")
+	fs.StringVar(&f.Inventory, "inventory", "", "provide a json or StationXML station inventory for use in file name templates")
+	fs.StringVar(&f.Zone, "zone", "UTC", "time zone used for file names, e.g. Pacific/Auckland")
+	fs.StringVar(&f.Precision, "precision", "", "per stream value formatting as GLOB=PRECISION rules, e.g. \"NZ_*_*_LK?=fixed:1,*=sig:7\"")
+	fs.StringVar(&f.Format, "format", "csv", "output format, one of: "+strings.Join(raw.Formats(), ", "))
+	fs.DurationVar(&f.Align, "align", 0, "align wide format readings to the nearest multiple of this interval")
+	fs.BoolVar(&f.Gzip, "gzip", false, "gzip compress output files, adding a .gz suffix to the file names")
+}
+
+// Output builds codecs and file names for storing readings.
+type Output struct {
+	*raw.Template
+
+	format raw.Format
+	dp     int
+	align  time.Duration
+	rules  raw.PrecisionRules
+}
+
+// Codec returns a new reader and writer for the output format.
+func (o *Output) Codec() raw.ReadWriter {
+	rw := o.format.New(o.dp)
+	// wide output may need readings aligned to common epochs
+	switch c := rw.(type) {
+	case *raw.Wide:
+		c.Tolerance, c.Precision = o.align, o.rules
+	case *raw.Jsonl:
+		c.Precision = o.rules
+	case *raw.Csv:
+		c.Precision = o.rules
+	}
+	return rw
+}
+
+// Store merges readings into the files below the given directory, malformed rows dropped from
+// existing files are logged.
+func (o *Output) Store(dir string, readings []raw.Reading) error {
+	rejects, err := raw.Store(dir, o.Codec(), o.Execute, readings)
+	logRejects(rejects)
+	return err
+}
+
+// Merge merges readings into a single file, malformed rows dropped from it are logged.
+func (o *Output) Merge(path string, readings []raw.Reading) error {
+	rejects, err := raw.MergeFile(path, o.Codec(), readings)
+	logRejects(rejects)
+	return err
+}
+
+func logRejects(rejects []*raw.ParseError) {
+	for _, r := range rejects {
+		log.Printf("dropped malformed row: %v", r)
+	}
+}
+
+// Output checks the options once the flag set has been parsed, unless a template was given
+// the default file names follow the output format.
+func (f *Flags) Output(fs *flag.FlagSet) (*Output, error) {
+	format, err := raw.OutputFormat(f.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := raw.ParsePrecisionRules(f.Precision)
+	if err != nil {
+		return nil, err
+	}
+	// fixed width and binary formats have no choice of value formatting
+	if len(rules) > 0 {
+		switch format.New(f.DecimalPlace).(type) {
+		case *raw.Csv, *raw.Jsonl, *raw.Wide:
+		default:
+			return nil, fmt.Errorf("-precision can't be used with the %s format", format.Name)
+		}
+	}
+
+	tmpl := f.Template
+	if !isSet(fs, "template") {
+		tmpl = strings.TrimSuffix(tmpl, ".csv") + format.Extension()
+	}
+	if f.Gzip && raw.Compression(tmpl) == "" {
+		tmpl += ".gz"
+	}
+
+	loc, err := time.LoadLocation(f.Zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone: %v", err)
+	}
+
+	var inv *raw.Inventory
+	if f.Inventory != "" {
+		if inv, err = raw.ReadInventory(f.Inventory); err != nil {
+			return nil, fmt.Errorf("unable to read inventory: %v", err)
+		}
+	}
+
+	t, err := raw.NewTemplateWith(tmpl, loc, inv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Output{
+		Template: t,
+		format:   format,
+		dp:       f.DecimalPlace,
+		align:    f.Align,
+		rules:    rules,
+	}, nil
+}
+
+// isSet checks whether a flag was given on the command line.
+func isSet(fs *flag.FlagSet, name string) bool {
+	var found bool
+	fs.Visit(func(f *flag.Flag) {
+		found = found || f.Name == name
+	})
+	return found
+}
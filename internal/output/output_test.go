@@ -0,0 +1,108 @@
+package output
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+func TestOutput_Template(t *testing.T) {
+
+	r := raw.Reading{Source: "NZ_APIM_50_LFZ", Epoch: time.Date(2016, time.August, 2, 4, 16, 5, 0, time.UTC), Value: 1}
+
+	var tests = []struct {
+		args []string
+		name string
+	}{
+		{nil, "2016/2016.215/2016.215.04.NZ_APIM_50_LFZ.csv"},
+		{[]string{"-format", "jsonl", "-gzip"}, "2016/2016.215/2016.215.04.NZ_APIM_50_LFZ.jsonl.gz"},
+		{[]string{"-format", "jsonl", "-template", "{{.Source}}.csv"}, "NZ_APIM_50_LFZ.csv"},
+		{[]string{"-format", "mseed"}, "2016/2016.215/2016.215.04.NZ_APIM_50_LFZ.mseed"},
+		{[]string{"-zone", "Pacific/Auckland", "-template", "{{Hour .Epoch}}.csv"}, "16.csv"},
+	}
+
+	for _, x := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+		var f Flags
+		f.Register(fs)
+		if err := fs.Parse(x.args); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := f.Output(fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := out.Execute(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != x.name {
+			t.Errorf("invalid file name for %v, expected %s found %s", x.args, x.name, name)
+		}
+	}
+}
+
+func TestOutput_Codec(t *testing.T) {
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var f Flags
+	f.Register(fs)
+	if err := fs.Parse([]string{"-format", "wide", "-align", "1s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := f.Output(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := out.Codec().(*raw.Wide)
+	if !ok || w.Tolerance != time.Second {
+		t.Errorf("invalid wide codec: %#v", out.Codec())
+	}
+
+	// the precision rules apply to every text format with free value formatting
+	for _, format := range []string{"csv", "jsonl", "wide"} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+		var f Flags
+		f.Register(fs)
+		if err := fs.Parse([]string{"-format", format, "-precision", "NZ_*=fixed:1"}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := f.Output(fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rules raw.PrecisionRules
+		switch c := out.Codec().(type) {
+		case *raw.Csv:
+			rules = c.Precision
+		case *raw.Jsonl:
+			rules = c.Precision
+		case *raw.Wide:
+			rules = c.Precision
+		}
+		if len(rules) != 1 {
+			t.Errorf("%s: expected the precision rules to be applied", format)
+		}
+	}
+
+	for _, args := range [][]string{{"-format", "mseed", "-precision", "NZ_*=fixed:1"}, {"-zone", "Nowhere/Special"}, {"-precision", "x"}, {"-inventory", "missing.json"}, {"-format", "iaga2002", "-precision", "NZ_*=fixed:1"}} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+		var f Flags
+		f.Register(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Output(fs); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package raw
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// StationInfo holds the station metadata available to templates.
+type StationInfo struct {
+	Network string `json:"network"`
+	Station string `json:"station"`
+
+	// observatory code, e.g. API
+	IAGA string `json:"iaga,omitempty"`
+	// observatory name, e.g. Apia
+	Name string `json:"name,omitempty"`
+	// publication state, e.g. variation, provisional, quasi-definitive or definitive
+	Type string `json:"type,omitempty"`
+	// sampling interval label, e.g. sec or min
+	Interval string `json:"interval,omitempty"`
+
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Elevation float64 `json:"elevation,omitempty"`
+}
+
+// TypeCode returns the single letter used for the publication state in INTERMAGNET file names.
+func (s StationInfo) TypeCode() string {
+	if s.Type == "" {
+		return ""
+	}
+	return strings.ToLower(s.Type[0:1])
+}
+
+// Inventory maps streams to their station metadata.
+type Inventory struct {
+	Stations []StationInfo `json:"stations"`
+}
+
+// Lookup finds the station metadata for a source name.
+func (i *Inventory) Lookup(source string) (StationInfo, bool) {
+	if i == nil {
+		return StationInfo{}, false
+	}
+	parts := strings.Split(source, "_")
+	if len(parts) < 2 {
+		return StationInfo{}, false
+	}
+	for _, s := range i.Stations {
+		if s.Network == parts[0] && s.Station == parts[1] {
+			return s, true
+		}
+	}
+	return StationInfo{}, false
+}
+
+// stationXML holds the parts of an FDSN StationXML document used for the inventory, the
+// station alternate code is taken as the IAGA code.
+type stationXML struct {
+	Networks []struct {
+		Code     string `xml:"code,attr"`
+		Stations []struct {
+			Code          string  `xml:"code,attr"`
+			AlternateCode string  `xml:"alternateCode,attr"`
+			Latitude      float64 `xml:"Latitude"`
+			Longitude     float64 `xml:"Longitude"`
+			Elevation     float64 `xml:"Elevation"`
+			Site          struct {
+				Name string `xml:"Name"`
+			} `xml:"Site"`
+			Channels []struct {
+				SampleRate float64 `xml:"SampleRate"`
+			} `xml:"Channel"`
+		} `xml:"Station"`
+	} `xml:"Network"`
+}
+
+// sampleInterval labels a sampling rate, e.g. 1 Hz as sec.
+func sampleInterval(rate float64) string {
+	for _, x := range []struct {
+		period float64
+		label  string
+	}{{1, "sec"}, {10, "10sec"}, {60, "min"}, {3600, "hor"}, {86400, "day"}} {
+		if rate > 0 && math.Abs(1.0/rate-x.period) < x.period*0.01 {
+			return x.label
+		}
+	}
+	return ""
+}
+
+func decodeStationXML(rd io.Reader) (*Inventory, error) {
+	var doc stationXML
+	if err := xml.NewDecoder(rd).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var inv Inventory
+	for _, n := range doc.Networks {
+		for _, s := range n.Stations {
+			// only label the interval if all channels agree
+			var interval string
+			for i, c := range s.Channels {
+				switch l := sampleInterval(c.SampleRate); {
+				case i == 0:
+					interval = l
+				case l != interval:
+					interval = ""
+				}
+			}
+			inv.Stations = append(inv.Stations, StationInfo{
+				Network:   n.Code,
+				Station:   s.Code,
+				IAGA:      s.AlternateCode,
+				Name:      s.Site.Name,
+				Interval:  interval,
+				Latitude:  s.Latitude,
+				Longitude: s.Longitude,
+				Elevation: s.Elevation,
+			})
+		}
+	}
+
+	return &inv, nil
+}
+
+// DecodeInventory reads either a json inventory or an FDSN StationXML document.
+func DecodeInventory(rd io.Reader) (*Inventory, error) {
+	br := bufio.NewReader(rd)
+
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(head), []byte("<")) {
+		return decodeStationXML(br)
+	}
+
+	var inv Inventory
+	if err := json.NewDecoder(br).Decode(&inv); err != nil {
+		return nil, err
+	}
+	for n, s := range inv.Stations {
+		if s.Network == "" || s.Station == "" {
+			return nil, fmt.Errorf("inventory station %d: missing network or station code", n+1)
+		}
+	}
+
+	return &inv, nil
+}
+
+// ReadInventory reads a json or StationXML inventory file.
+func ReadInventory(path string) (*Inventory, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	inv, err := DecodeInventory(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return inv, nil
+}
@@ -0,0 +1,117 @@
+package raw
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+const testInventoryJSON = `{
+  "stations": [
+    {"network": "NZ", "station": "APIM", "iaga": "API", "name": "Apia", "type": "variation", "interval": "sec", "latitude": -13.807, "longitude": -171.775}
+  ]
+}`
+
+const testInventoryXML = `<?xml version="1.0" encoding="UTF-8"?>
+<FDSNStationXML xmlns="http://www.fdsn.org/xml/station/1" schemaVersion="1.1">
+  <Source>test</Source>
+  <Network code="NZ">
+    <Station code="APIM" alternateCode="API">
+      <Latitude>-13.807</Latitude>
+      <Longitude>-171.775</Longitude>
+      <Elevation>2</Elevation>
+      <Site><Name>Apia</Name></Site>
+      <Channel code="LFZ" locationCode="50"><SampleRate>1</SampleRate></Channel>
+      <Channel code="LFX" locationCode="50"><SampleRate>1</SampleRate></Channel>
+    </Station>
+    <Station code="EYWM">
+      <Site><Name>Eyrewell</Name></Site>
+      <Channel code="LFZ" locationCode="50"><SampleRate>1</SampleRate></Channel>
+      <Channel code="UFZ" locationCode="50"><SampleRate>0.0166667</SampleRate></Channel>
+    </Station>
+  </Network>
+</FDSNStationXML>`
+
+func TestInventory_Decode(t *testing.T) {
+
+	for _, s := range []string{testInventoryJSON, testInventoryXML} {
+		inv, err := DecodeInventory(bytes.NewBufferString(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, ok := inv.Lookup("NZ_APIM_50_LFZ")
+		if !ok {
+			t.Fatal("missing station metadata for NZ_APIM_50_LFZ")
+		}
+		if info.IAGA != "API" || info.Name != "Apia" || info.Interval != "sec" || info.Latitude != -13.807 {
+			t.Errorf("invalid station metadata: %+v", info)
+		}
+		if _, ok := inv.Lookup("NZ_SBAM_50_LFZ"); ok {
+			t.Error("unexpected station metadata for NZ_SBAM_50_LFZ")
+		}
+	}
+
+	inv, err := DecodeInventory(bytes.NewBufferString(testInventoryXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := inv.Lookup("NZ_EYWM_50_LFZ"); info.Interval != "" {
+		t.Errorf("unexpected interval for mixed sampling rates: %s", info.Interval)
+	}
+
+	if _, err := DecodeInventory(bytes.NewBufferString(`{"stations": [{"iaga": "API"}]}`)); err == nil {
+		t.Error("expected an error for a station without codes")
+	}
+}
+
+func TestInventory_Template(t *testing.T) {
+
+	inv, err := DecodeInventory(bytes.NewBufferString(testInventoryJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := NewTemplateWith("{{Lower (IAGA .)}}{{Year .Epoch}}{{Month .Epoch}}{{Day .Epoch}}{{TypeCode .}}{{Interval .}}.{{Interval .}}", nil, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Reading{"NZ_APIM_50_LFZ", time.Date(2016, time.August, 2, 4, 16, 5, 0, time.UTC), 1.0}
+
+	s, err := tmpl.Execute(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "api20160802vsec.sec" {
+		t.Errorf("invalid template output, expected %q found %q", "api20160802vsec.sec", s)
+	}
+
+	named, err := NewTemplateWith("{{Observatory .}}/{{(Meta .).IAGA}}", nil, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := named.Execute(r); err != nil || s != "Apia/API" {
+		t.Errorf("invalid template output, expected %q found %q: %v", "Apia/API", s, err)
+	}
+
+	// streams without metadata can't be named
+	r.Source = "NZ_SBAM_50_LFZ"
+	if _, err := tmpl.Execute(r); err == nil {
+		t.Error("expected an error for a station without metadata")
+	}
+
+	// metadata functions need an inventory
+	if _, err := NewTemplate("{{IAGA .}}"); err == nil {
+		t.Error("expected an error without an inventory")
+	}
+
+	// only some stations need the metadata used by the template
+	partial := &Inventory{Stations: []StationInfo{{Network: "NZ", Station: "SBAM"}, inv.Stations[0]}}
+	if _, err := NewTemplateWith("{{IAGA .}}.csv", nil, partial); err != nil {
+		t.Errorf("unexpected error for a partial inventory: %v", err)
+	}
+	if _, err := NewTemplateWith("{{IAGA .}}.csv", nil, &Inventory{Stations: partial.Stations[:1]}); err == nil {
+		t.Error("expected an error when no station has the metadata")
+	}
+}
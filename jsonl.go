@@ -0,0 +1,200 @@
+package raw
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:       "jsonl",
+		Extensions: []string{".jsonl", ".ndjson"},
+		New: func(dp int) ReadWriter {
+			return NewJsonl(dp)
+		},
+		Sniff: func(head []byte) bool {
+			return bytes.HasPrefix(bytes.TrimSpace(head), []byte("{")) && bytes.Contains(head, []byte(`"source"`))
+		},
+	})
+}
+
+// Jsonl reads and writes readings as JSON Lines, one object per reading with source, time and value
+// fields. Optional quality and unit fields are written for every reading when given and checked on reading.
+type Jsonl struct {
+	DecimalPlace *int
+
+	// optional per stream formatting, streams without a matching rule use the decimal places
+	Precision PrecisionRules
+
+	Quality string
+	Unit    string
+}
+
+func NewJsonl(dp int) *Jsonl {
+	return &Jsonl{
+		DecimalPlace: &dp,
+	}
+}
+
+// jsonlReading is used to validate decoded lines, pointers distinguish missing fields.
+type jsonlReading struct {
+	Source  *string  `json:"source"`
+	Time    *string  `json:"time"`
+	Value   *float64 `json:"value"`
+	Quality *string  `json:"quality,omitempty"`
+	Unit    *string  `json:"unit,omitempty"`
+}
+
+func (j Jsonl) decode(line []byte) (Reading, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+
+	var v jsonlReading
+	if err := dec.Decode(&v); err != nil {
+		return Reading{}, err
+	}
+	if dec.More() {
+		return Reading{}, fmt.Errorf("unexpected data after reading")
+	}
+
+	switch {
+	case v.Source == nil || *v.Source == "":
+		return Reading{}, fmt.Errorf("missing source")
+	case v.Time == nil:
+		return Reading{}, fmt.Errorf("missing time")
+	case v.Value == nil:
+		return Reading{}, fmt.Errorf("missing value")
+	case j.Quality != "" && v.Quality != nil && *v.Quality != j.Quality:
+		return Reading{}, fmt.Errorf("unexpected quality %q", *v.Quality)
+	case j.Unit != "" && v.Unit != nil && *v.Unit != j.Unit:
+		return Reading{}, fmt.Errorf("unexpected unit %q", *v.Unit)
+	}
+
+	var t time.Time
+	if err := t.UnmarshalText([]byte(*v.Time)); err != nil {
+		return Reading{}, fmt.Errorf("invalid time: %v", err)
+	}
+
+	return Reading{
+		Source: *v.Source,
+		Epoch:  t,
+		Value:  *v.Value,
+	}, nil
+}
+
+// Decode passes each reading to the given function as it is read, blank lines are skipped and
+// malformed lines return a *ParseError.
+func (j Jsonl) Decode(rd io.Reader, fn func(Reading) error) error {
+	return j.decodeLines(rd, fn, nil)
+}
+
+// decodeLines passes malformed lines to the reject function if one is given, rather than stopping.
+func (j Jsonl) decodeLines(rd io.Reader, fn func(Reading) error, reject func(*ParseError)) error {
+	br := bufio.NewReader(rd)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if b := bytes.TrimSpace(line); len(b) > 0 {
+			r, derr := j.decode(b)
+			switch {
+			case derr != nil && reject != nil:
+				reject(&ParseError{Line: n, Column: 1, Record: []string{string(b)}, Err: derr})
+			case derr != nil:
+				return &ParseError{Line: n, Column: 1, Record: []string{string(b)}, Err: derr}
+			default:
+				if err := fn(r); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (j Jsonl) Read(rd io.Reader) ([]Reading, error) {
+	var readings []Reading
+	if err := j.Decode(rd, func(r Reading) error {
+		readings = append(readings, r)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+// ReadRejects reads leniently, returning the valid readings together with any lines which could not be parsed.
+func (j Jsonl) ReadRejects(rd io.Reader) ([]Reading, []*ParseError, error) {
+	var readings []Reading
+	var rejects []*ParseError
+	if err := j.decodeLines(rd, func(r Reading) error {
+		readings = append(readings, r)
+		return nil
+	}, func(perr *ParseError) {
+		rejects = append(rejects, perr)
+	}); err != nil {
+		return nil, nil, err
+	}
+	return readings, rejects, nil
+}
+
+// Encode formats a single reading as a JSON object, the fields are always in the same order
+// so that unchanged files compare equal.
+func (j Jsonl) Encode(r Reading) ([]byte, error) {
+	if math.IsNaN(r.Value) || math.IsInf(r.Value, 0) {
+		return nil, fmt.Errorf("unable to encode %s value: %g", r.Source, r.Value)
+	}
+
+	source, err := json.Marshal(r.Source)
+	if err != nil {
+		return nil, err
+	}
+	epoch, err := r.Epoch.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"source":`)
+	buf.Write(source)
+	buf.WriteString(`,"time":"`)
+	buf.Write(epoch)
+	buf.WriteString(`","value":`)
+	buf.WriteString(j.Precision.Select(r.Source, j.DecimalPlace).Format(r.Value))
+	for _, f := range []struct{ k, v string }{{"quality", j.Quality}, {"unit", j.Unit}} {
+		if f.v == "" {
+			continue
+		}
+		v, err := json.Marshal(f.v)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`,"` + f.k + `":`)
+		buf.Write(v)
+	}
+	buf.WriteString("}")
+
+	return buf.Bytes(), nil
+}
+
+func (j Jsonl) Write(wr io.Writer, rr []Reading) error {
+	w := bufio.NewWriter(wr)
+	for _, r := range rr {
+		b, err := j.Encode(r)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
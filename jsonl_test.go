@@ -0,0 +1,157 @@
+package raw
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJsonl_RoundTrip(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 500000000, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LFZ", at, -41221.25},
+		{"NZ_APIM_50_LFZ", at.Add(time.Second), -41220},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Jsonl{Unit: "nT"}, readings); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"source":"NZ_APIM_50_LFZ","time":"2016-08-02T04:00:00.5Z","value":-41221.25,"unit":"nT"}
+{"source":"NZ_APIM_50_LFZ","time":"2016-08-02T04:00:01.5Z","value":-41220,"unit":"nT"}
+`
+	if buf.String() != expected {
+		t.Errorf("invalid jsonl output, expected:\n%s\nfound:\n%s", expected, buf.String())
+	}
+
+	r, err := Read(bytes.NewBufferString(buf.String()), Jsonl{Unit: "nT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != len(readings) {
+		t.Fatalf("invalid number of readings, expected %d found %d", len(readings), len(r))
+	}
+	for i := range readings {
+		if !r[i].Equal(readings[i]) || r[i].Value != readings[i].Value {
+			t.Errorf("invalid reading %d, expected %s found %s", i, readings[i], r[i])
+		}
+	}
+}
+
+func TestJsonl_Precision(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LKO", at, 12.3456},
+		{"NZ_APIM_50_LFZ", at, -41221.256},
+		{"NZ_APIM_50_LFX", at, -0.04},
+	}
+
+	rules, err := ParsePrecisionRules("NZ_*_*_LK?=fixed:1,NZ_*_*_LFZ=sig:6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Jsonl{DecimalPlace: new(int), Precision: rules}, readings); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"source":"NZ_APIM_50_LKO","time":"2016-08-02T04:00:00Z","value":12.3}
+{"source":"NZ_APIM_50_LFZ","time":"2016-08-02T04:00:00Z","value":-41221.3}
+{"source":"NZ_APIM_50_LFX","time":"2016-08-02T04:00:00Z","value":0}
+`
+	if buf.String() != expected {
+		t.Errorf("invalid jsonl output, expected:\n%s\nfound:\n%s", expected, buf.String())
+	}
+}
+
+func TestJsonl_Invalid(t *testing.T) {
+
+	var tests = []struct {
+		s string
+		e string
+	}{
+		{`{"source":"A","time":"2016-08-02T04:00:00Z"}`, "line 1, column 1: missing value"},
+		{"\n" + `{"time":"2016-08-02T04:00:00Z","value":1}`, "line 2, column 1: missing source"},
+		{`{"source":"A","time":"yesterday","value":1}`, "line 1, column 1: invalid time"},
+		{`{"source":"A","time":"2016-08-02T04:00:00Z","value":"1"}`, "line 1, column 1: json"},
+		{`{"source":"A","time":"2016-08-02T04:00:00Z","value":1,"extra":1}`, "line 1, column 1: json: unknown field"},
+		{`{"source":"A","time":"2016-08-02T04:00:00Z","value":1} {}`, "line 1, column 1: unexpected data"},
+		{`{"source":"A","time":"2016-08-02T04:00:00Z","value":1,"unit":"mV"}`, "line 1, column 1: unexpected unit"},
+	}
+
+	for _, x := range tests {
+		_, err := Read(bytes.NewBufferString(x.s), Jsonl{Unit: "nT"})
+		switch {
+		case err == nil:
+			t.Errorf("expected an error for %q", x.s)
+		case !strings.HasPrefix(err.Error(), x.e):
+			t.Errorf("invalid error for %q, expected %q found %q", x.s, x.e, err.Error())
+		}
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("expected a parse error for %q, found %T", x.s, err)
+		}
+	}
+
+	// lenient reading keeps the good lines
+	s := `{"source":"A","time":"2016-08-02T04:00:00Z","value":1}` + "\n{}\n" + `{"source":"A","time":"2016-08-02T04:00:01Z","value":2}`
+	r, rejects, err := Jsonl{}.ReadRejects(bytes.NewBufferString(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || len(rejects) != 1 || rejects[0].Line != 2 {
+		t.Errorf("invalid lenient read, found %d readings and rejects %v", len(r), rejects)
+	}
+}
+
+func TestJsonl_ReadWriteFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.jsonl")
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	readings := []Reading{{"NZ_APIM_50_LFZ", at, 1.5}, {"NZ_APIM_50_LFZ", at.Add(time.Second), 2.5}}
+
+	if err := ReadWriteFile(path, NewJsonl(2), readings); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unchanged readings should leave the file alone
+	time.Sleep(10 * time.Millisecond)
+	if err := ReadWriteFile(path, NewJsonl(2), readings[1:]); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("unchanged jsonl file was rewritten")
+	}
+
+	r, err := ReadFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != len(readings) {
+		t.Errorf("invalid number of readings, expected %d found %d", len(readings), len(r))
+	}
+}
@@ -1,13 +1,213 @@
 package raw
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/GeoNet/mseed"
 )
 
+func init() {
+	RegisterFormat(Format{
+		Name:       "mseed",
+		Extensions: []string{".mseed", ".miniseed", ".ms"},
+		New: func(int) ReadWriter {
+			return NewMSeed(0.0, 1.0)
+		},
+		Sniff: sniffMSeed,
+	})
+}
+
+// miniseed records are written as a fixed header and a blockette 1000 followed by uncompressed samples.
+const (
+	mseedRecordSize = 512
+	mseedDataOffset = 64
+
+	mseedInt32   = 3
+	mseedFloat64 = 5
+)
+
+// MSeed reads fixed size miniseed records, and writes uncompressed 512 byte records holding 32 bit integers
+// when every sample in the record is a whole number and 64 bit floats otherwise. Values are converted back
+// to samples by removing the offset and scale, and a record is started at every gap in the sampling.
+type MSeed struct {
+	Offset float64
+	Scale  float64
+}
+
+func NewMSeed(offset, scale float64) *MSeed {
+	return &MSeed{
+		Offset: offset,
+		Scale:  scale,
+	}
+}
+
+func (m MSeed) Read(rd io.Reader) ([]Reading, error) {
+	return ReadMSeedStream(rd, m.Offset, m.Scale)
+}
+
+func (m MSeed) Write(wr io.Writer, rr []Reading) error {
+	var sources []string
+	streams := make(map[string][]Reading)
+	for _, r := range Sort(rr) {
+		if _, ok := streams[r.Source]; !ok {
+			sources = append(sources, r.Source)
+		}
+		streams[r.Source] = append(streams[r.Source], r)
+	}
+
+	var seq int
+	for _, source := range sources {
+		readings := streams[source]
+
+		// single samples keep the interval of the stream, if there is one
+		interval := time.Second
+		for len(readings) > 0 {
+			n, dt := mseedRun(readings, (mseedRecordSize-mseedDataOffset)/4)
+			if dt > 0 {
+				interval = dt
+			}
+
+			samples := make([]float64, n)
+			encoding := mseedInt32
+			for i, r := range readings[:n] {
+				samples[i] = r.Value - m.Offset
+				if m.Scale != 0.0 {
+					samples[i] /= m.Scale
+				}
+				if samples[i] != math.Trunc(samples[i]) || samples[i] < math.MinInt32 || samples[i] > math.MaxInt32 {
+					encoding = mseedFloat64
+				}
+			}
+			if encoding == mseedFloat64 && n > (mseedRecordSize-mseedDataOffset)/8 {
+				n = (mseedRecordSize - mseedDataOffset) / 8
+			}
+
+			seq++
+			record, err := mseedRecord(source, seq, readings[0].Epoch, interval, encoding, samples[:n])
+			if err != nil {
+				return err
+			}
+			if _, err := wr.Write(record); err != nil {
+				return err
+			}
+
+			readings = readings[n:]
+		}
+	}
+
+	return nil
+}
+
+// mseedRun returns how many leading readings, up to a limit, are evenly spaced and their spacing.
+func mseedRun(readings []Reading, limit int) (int, time.Duration) {
+	if len(readings) < 2 {
+		return len(readings), 0
+	}
+	dt := readings[1].Epoch.Sub(readings[0].Epoch)
+	if dt <= 0 {
+		return 1, 0
+	}
+
+	n := 2
+	for ; n < len(readings) && n < limit; n++ {
+		if gap := readings[n].Epoch.Sub(readings[n-1].Epoch) - dt; gap < -dt/100 || gap > dt/100 {
+			break
+		}
+	}
+	return n, dt
+}
+
+// mseedRate finds the sample rate factor and multiplier which give the sample interval exactly.
+func mseedRate(dt time.Duration) (int16, int16, error) {
+	rate := float64(time.Second) / float64(dt)
+	for m := 1; m <= math.MaxInt16; m++ {
+		f := math.Round(rate * float64(m))
+		if f < 1 || f > math.MaxInt16 || math.Abs(f-rate*float64(m)) > 1e-6*f {
+			continue
+		}
+		if m == 1 {
+			return int16(f), 1, nil
+		}
+		return int16(f), -int16(m), nil
+	}
+	return 0, 0, fmt.Errorf("unsupported miniseed sample interval: %s", dt)
+}
+
+// mseedRecord encodes a big endian data record.
+func mseedRecord(source string, seq int, start time.Time, dt time.Duration, encoding int, samples []float64) ([]byte, error) {
+	parts := strings.Split(source, "_")
+	if len(parts) != 4 || len(parts[0]) > 2 || len(parts[1]) > 5 || len(parts[2]) > 2 || len(parts[3]) > 3 {
+		return nil, fmt.Errorf("invalid miniseed source, expected NET_STA_LOC_CHA: %s", source)
+	}
+	factor, multiplier, err := mseedRate(dt)
+	if err != nil {
+		return nil, err
+	}
+
+	// times are held to a tenth of a millisecond
+	at := start.UTC().Round(100 * time.Microsecond)
+
+	buf := make([]byte, mseedRecordSize)
+	copy(buf[0:8], fmt.Sprintf("%06dD ", seq%1000000))
+	copy(buf[8:20], fmt.Sprintf("%-5s%-2s%-3s%-2s", parts[1], parts[2], parts[3], parts[0]))
+
+	order := binary.BigEndian
+	order.PutUint16(buf[20:22], uint16(at.Year()))
+	order.PutUint16(buf[22:24], uint16(at.YearDay()))
+	buf[24], buf[25], buf[26] = byte(at.Hour()), byte(at.Minute()), byte(at.Second())
+	order.PutUint16(buf[28:30], uint16(at.Nanosecond()/100000))
+	order.PutUint16(buf[30:32], uint16(len(samples)))
+	order.PutUint16(buf[32:34], uint16(factor))
+	order.PutUint16(buf[34:36], uint16(multiplier))
+	buf[39] = 1
+	order.PutUint16(buf[44:46], mseedDataOffset)
+	order.PutUint16(buf[46:48], 48)
+
+	// blockette 1000 gives the encoding, byte order and record length as a power of two
+	order.PutUint16(buf[48:50], 1000)
+	buf[52], buf[53], buf[54] = byte(encoding), 1, 9
+
+	for i, v := range samples {
+		switch encoding {
+		case mseedInt32:
+			order.PutUint32(buf[mseedDataOffset+4*i:], uint32(int32(v)))
+		default:
+			order.PutUint64(buf[mseedDataOffset+8*i:], math.Float64bits(v))
+		}
+	}
+
+	return buf, nil
+}
+
+// sniffMSeed checks for a fixed header sequence number, quality indicator and plausible start year.
+func sniffMSeed(head []byte) bool {
+	if len(head) < 48 {
+		return false
+	}
+	for _, c := range head[0:6] {
+		if (c < '0' || c > '9') && c != ' ' {
+			return false
+		}
+	}
+	switch head[6] {
+	case 'D', 'R', 'Q', 'M':
+	default:
+		return false
+	}
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		if y := order.Uint16(head[20:22]); y >= 1900 && y <= 2100 {
+			return true
+		}
+	}
+	return false
+}
+
 func DecodeMSeedBuffer(buf []byte, offset, scale float64) ([]Reading, error) {
 	var readings []Reading
 
@@ -1,8 +1,15 @@
 package raw
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"math"
+	"sort"
 	"testing"
+	"time"
+
+	"github.com/ozym/raw/seedlink"
 )
 
 func TestMSeed_File(t *testing.T) {
@@ -52,3 +59,144 @@ func TestMSeed_File(t *testing.T) {
 
 	}
 }
+
+// testRecord decodes the header and samples of a written record.
+func testRecord(t *testing.T, buf []byte) (seedlink.Header, []float64) {
+	h, err := seedlink.DecodeHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := binary.BigEndian.Uint16(buf[48:50]); b != 1000 {
+		t.Fatalf("invalid blockette, expected 1000 found %d", b)
+	}
+
+	var samples []float64
+	for i := 0; i < h.Samples; i++ {
+		switch buf[52] {
+		case mseedInt32:
+			samples = append(samples, float64(int32(binary.BigEndian.Uint32(buf[mseedDataOffset+4*i:]))))
+		case mseedFloat64:
+			samples = append(samples, math.Float64frombits(binary.BigEndian.Uint64(buf[mseedDataOffset+8*i:])))
+		default:
+			t.Fatalf("invalid encoding: %d", buf[52])
+		}
+	}
+	return h, samples
+}
+
+func TestMSeed_Write(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 69500000, time.UTC)
+
+	// whole numbers at 1 Hz with a gap, and fractions at 10 Hz
+	var readings []Reading
+	for i := 0; i < 150; i++ {
+		readings = append(readings, Reading{"NZ_APIM_50_LFZ", at.Add(time.Duration(i) * time.Second), float64(-41221 + i)})
+	}
+	for i := 0; i < 3; i++ {
+		readings = append(readings, Reading{"NZ_APIM_50_LFZ", at.Add(time.Duration(200+i) * time.Second), float64(i)})
+	}
+	for i := 0; i < 60; i++ {
+		readings = append(readings, Reading{"NZ_APIM__HKO", at.Add(time.Duration(i) * 100 * time.Millisecond), 12.25 + float64(i)})
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, NewMSeed(1.0, 0.5), readings); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len()%mseedRecordSize != 0 {
+		t.Fatalf("invalid miniseed length: %d", buf.Len())
+	}
+
+	var tests = []struct {
+		source  string
+		start   time.Time
+		rate    float64
+		samples int
+		first   float64
+	}{
+		{"NZ_APIM_50_LFZ", at, 1, 112, -82444},
+		{"NZ_APIM_50_LFZ", at.Add(112 * time.Second), 1, 38, -82220},
+		{"NZ_APIM_50_LFZ", at.Add(200 * time.Second), 1, 3, -2},
+		{"NZ_APIM__HKO", at, 10, 56, 22.5},
+		{"NZ_APIM__HKO", at.Add(5600 * time.Millisecond), 10, 4, 134.5},
+	}
+
+	// sources are written in order
+	sort.SliceStable(tests, func(i, j int) bool { return tests[i].source < tests[j].source })
+
+	if n := buf.Len() / mseedRecordSize; n != len(tests) {
+		t.Fatalf("invalid number of records, expected %d found %d", len(tests), n)
+	}
+	for i, x := range tests {
+		h, samples := testRecord(t, buf.Bytes()[i*mseedRecordSize:(i+1)*mseedRecordSize])
+		if h.SequenceNumber != fmt.Sprintf("%06d", i+1) {
+			t.Errorf("record %d: invalid sequence number %q", i, h.SequenceNumber)
+		}
+		if h.SrcName() != x.source || !h.StartTime.Equal(x.start) || h.SampleRate != x.rate {
+			t.Errorf("record %d: invalid header, expected %s %s %g found %s %s %g", i, x.source, x.start, x.rate, h.SrcName(), h.StartTime, h.SampleRate)
+		}
+		if len(samples) != x.samples || samples[0] != x.first {
+			t.Errorf("record %d: invalid samples, expected %d from %g found %d from %g", i, x.samples, x.first, len(samples), samples[0])
+		}
+	}
+
+	if err := Write(&buf, MSeed{}, []Reading{{"NZ_APIM_LFZ", at, 1}}); err == nil {
+		t.Error("expected an error for an invalid miniseed source")
+	}
+}
+
+func TestMSeed_Rate(t *testing.T) {
+
+	for _, x := range []struct {
+		dt     time.Duration
+		factor int16
+		mult   int16
+	}{
+		{time.Second, 1, 1},
+		{10 * time.Millisecond, 100, 1},
+		{time.Minute, 1, -60},
+		{1500 * time.Millisecond, 2, -3},
+		{300 * time.Millisecond, 10, -3},
+	} {
+		f, m, err := mseedRate(x.dt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f != x.factor || m != x.mult {
+			t.Errorf("%s: invalid rate, expected %d/%d found %d/%d", x.dt, x.factor, x.mult, f, m)
+		}
+	}
+
+	if _, _, err := mseedRate(time.Hour * 24 * 365); err == nil {
+		t.Error("expected an error for an unsupported sample interval")
+	}
+}
+
+func TestMSeed_RoundTrip(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	var readings []Reading
+	for i := 0; i < 200; i++ {
+		readings = append(readings, Reading{"NZ_APIM_50_LFZ", at.Add(time.Duration(i) * time.Second), float64(-41221 + i)})
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, MSeed{Scale: 1.0}, readings); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ReadMSeedStream(&buf, 0.0, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != len(readings) {
+		t.Fatalf("invalid number of readings, expected %d found %d", len(readings), len(r))
+	}
+	for i := range readings {
+		if !r[i].Equal(readings[i]) || r[i].Value != readings[i].Value {
+			t.Errorf("invalid reading %d, expected %s found %s", i, readings[i], r[i])
+		}
+	}
+}
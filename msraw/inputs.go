@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+// list collects repeated or comma separated flag values.
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// parseTime accepts either an RFC3339 time or a plain UTC date.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
+
+// selected checks a file name against include and exclude glob patterns.
+func selected(path string, include, exclude []string) bool {
+	name := filepath.Base(path)
+	for _, p := range exclude {
+		if ok, _ := filepath.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, p := range include {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// expand converts arguments into a list of input files, directories are walked if recursive
+// and "-" is passed through for stdin.
+func expand(args []string, recursive bool, include, exclude []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if arg == "-" {
+			files = append(files, arg)
+			continue
+		}
+
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if selected(arg, include, exclude) {
+				files = append(files, arg)
+			}
+			continue
+		}
+		if !recursive {
+			return nil, fmt.Errorf("%s is a directory, use -recursive to read its contents", arg)
+		}
+
+		var found []string
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case d.IsDir() && path != arg && strings.HasPrefix(d.Name(), "."):
+				return filepath.SkipDir
+			case d.IsDir(), !d.Type().IsRegular(), strings.HasPrefix(d.Name(), "."):
+				return nil
+			case selected(path, include, exclude):
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+
+		files = append(files, found...)
+	}
+
+	return files, nil
+}
+
+// sdsPattern builds the glob for a stream's day file in an SDS archive, i.e.
+// YEAR/NET/STA/CHAN.D/NET.STA.LOC.CHAN.D.YEAR.DOY
+func sdsPattern(root, stream string, day time.Time) (string, error) {
+	parts := strings.Split(stream, "_")
+	if len(parts) > 4 {
+		return "", fmt.Errorf("invalid stream, expected NET_STA_LOC_CHA: %s", stream)
+	}
+	for len(parts) < 4 {
+		parts = append(parts, "*")
+	}
+	net, sta, loc, cha := parts[0], parts[1], parts[2], parts[3]
+
+	year, doy := day.Format("2006"), fmt.Sprintf("%03d", day.YearDay())
+
+	return filepath.Join(root, year, net, sta, cha+".D", strings.Join([]string{net, sta, loc, cha, "D", year, doy}, ".")), nil
+}
+
+// sdsFiles finds the day files in an SDS archive for the given stream patterns which overlap the time window.
+func sdsFiles(root string, streams []string, start, end time.Time) ([]string, error) {
+	if len(streams) == 0 {
+		streams = []string{"*"}
+	}
+
+	seen := make(map[string]bool)
+
+	var files []string
+	for day := start.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.Add(24 * time.Hour) {
+		for _, s := range streams {
+			pattern, err := sdsPattern(root, s, day)
+			if err != nil {
+				return nil, err
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range matches {
+				if !seen[m] {
+					files, seen[m] = append(files, m), true
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// window trims readings to those within the start and end times.
+func window(readings []raw.Reading, start, end time.Time) []raw.Reading {
+	var trimmed []raw.Reading
+	for _, r := range readings {
+		if r.Epoch.Before(start) || !r.Epoch.Before(end) {
+			continue
+		}
+		trimmed = append(trimmed, r)
+	}
+	return trimmed
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFiles creates empty files below a directory, returning their paths.
+func testFiles(t *testing.T, dir string, names ...string) []string {
+	var paths []string
+	for _, n := range names {
+		path := filepath.Join(dir, filepath.FromSlash(n))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestInputs_Selected(t *testing.T) {
+
+	for _, v := range []struct {
+		path     string
+		include  []string
+		exclude  []string
+		selected bool
+	}{
+		{"archive/NZ.APIM.50.LFZ.D.2016.215", nil, nil, true},
+		{"archive/NZ.APIM.50.LFZ.D.2016.215", []string{"*.D.*"}, nil, true},
+		{"archive/notes.txt", []string{"*.D.*"}, nil, false},
+		{"archive/NZ.APIM.50.LFZ.D.2016.215.tmp", []string{"*.D.*"}, []string{"*.tmp"}, false},
+		{"archive/NZ.APIM.50.LFZ.D.2016.215.tmp", nil, []string{"*.tmp"}, false},
+		// excludes win over includes whatever their order
+		{"archive/NZ.APIM.50.LFZ.D.2016.215", []string{"NZ.*"}, []string{"*.215"}, false},
+		{"archive/NZ.APIM.50.LFZ.D.2016.215", []string{"*.215", "NZ.*"}, []string{"*.216"}, true},
+		// globs match the file name rather than the path
+		{"archive/NZ.APIM.50.LFZ.D.2016.215", []string{"archive/*"}, nil, false},
+	} {
+		if s := selected(v.path, v.include, v.exclude); s != v.selected {
+			t.Errorf("%s (include %v, exclude %v): expected %v found %v", v.path, v.include, v.exclude, v.selected, s)
+		}
+	}
+}
+
+func TestInputs_Expand(t *testing.T) {
+
+	dir := t.TempDir()
+
+	testFiles(t, dir,
+		"b/NZ.EYWM.50.LFZ.D.2016.215",
+		"a/NZ.APIM.50.LFZ.D.2016.215",
+		"a/NZ.APIM.50.LFZ.D.2016.215.tmp",
+		"a/.NZ.APIM.50.LFZ.D.2016.216",
+		".hidden/NZ.SMHS.50.LFZ.D.2016.215",
+		"a/.partial/NZ.APIM.50.LFZ.D.2016.217",
+	)
+	single := testFiles(t, t.TempDir(), "NZ.APIM.50.LFZ.D.2016.218")[0]
+
+	// directories are walked in name order, skipping hidden files and directories
+	files, err := expand([]string{single, dir, "-"}, true, []string{"*.D.*"}, []string{"*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		single,
+		filepath.Join(dir, "a", "NZ.APIM.50.LFZ.D.2016.215"),
+		filepath.Join(dir, "b", "NZ.EYWM.50.LFZ.D.2016.215"),
+		"-",
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("invalid files, expected %v found %v", expected, files)
+	}
+
+	// a hidden directory given as an argument is still read
+	files, err = expand([]string{filepath.Join(dir, ".hidden")}, true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("invalid files from a hidden directory argument: %v", files)
+	}
+
+	// directories need -recursive
+	if _, err := expand([]string{dir}, false, nil, nil); err == nil || !strings.Contains(err.Error(), "-recursive") {
+		t.Errorf("expected an error asking for -recursive, found %v", err)
+	}
+
+	if _, err := expand([]string{filepath.Join(dir, "missing")}, true, nil, nil); err == nil {
+		t.Error("expected an error for a missing input")
+	}
+}
+
+func TestInputs_SdsPattern(t *testing.T) {
+
+	day := time.Date(2016, time.August, 2, 0, 0, 0, 0, time.UTC)
+
+	for _, v := range []struct {
+		stream  string
+		pattern string
+	}{
+		{"NZ_APIM_50_LFZ", "2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.215"},
+		{"NZ_APIM__LFZ", "2016/NZ/APIM/LFZ.D/NZ.APIM..LFZ.D.2016.215"},
+		{"NZ_APIM", "2016/NZ/APIM/*.D/NZ.APIM.*.*.D.2016.215"},
+		{"*", "2016/*/*/*.D/*.*.*.*.D.2016.215"},
+	} {
+		pattern, err := sdsPattern("sds", v.stream, day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := filepath.Join("sds", filepath.FromSlash(v.pattern)); pattern != expected {
+			t.Errorf("%s: invalid pattern, expected %s found %s", v.stream, expected, pattern)
+		}
+	}
+
+	if _, err := sdsPattern("sds", "NZ_APIM_50_LFZ_X", day); err == nil {
+		t.Error("expected an error for too many stream parts")
+	}
+}
+
+func TestInputs_SdsFiles(t *testing.T) {
+
+	root := t.TempDir()
+
+	testFiles(t, root,
+		"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.215",
+		"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.216",
+		"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.217",
+		"2016/NZ/APIM/LFZ.D/NZ.APIM..LFZ.D.2016.215",
+		"2016/NZ/EYWM/LFZ.D/NZ.EYWM.50.LFZ.D.2016.215",
+		"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.366",
+		"2017/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2017.001",
+	)
+
+	for _, v := range []struct {
+		streams    []string
+		start, end time.Time
+		files      []string
+	}{
+		// a window crossing midnight needs both days
+		{
+			[]string{"NZ_APIM_50_LFZ"},
+			time.Date(2016, time.August, 2, 20, 0, 0, 0, time.UTC),
+			time.Date(2016, time.August, 3, 2, 0, 0, 0, time.UTC),
+			[]string{"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.215", "2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.216"},
+		},
+		// an end at midnight doesn't include the next day
+		{
+			[]string{"NZ_APIM_50_LFZ"},
+			time.Date(2016, time.August, 2, 0, 0, 0, 0, time.UTC),
+			time.Date(2016, time.August, 3, 0, 0, 0, 0, time.UTC),
+			[]string{"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.215"},
+		},
+		// and across the end of a leap year
+		{
+			[]string{"NZ_APIM_50_LFZ"},
+			time.Date(2016, time.December, 31, 12, 0, 0, 0, time.UTC),
+			time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC),
+			[]string{"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.366", "2017/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2017.001"},
+		},
+		// empty location codes
+		{
+			[]string{"NZ_APIM__LFZ"},
+			time.Date(2016, time.August, 2, 0, 0, 0, 0, time.UTC),
+			time.Date(2016, time.August, 3, 0, 0, 0, 0, time.UTC),
+			[]string{"2016/NZ/APIM/LFZ.D/NZ.APIM..LFZ.D.2016.215"},
+		},
+		// overlapping patterns give each file once
+		{
+			[]string{"NZ_APIM", "NZ_*_50_LFZ"},
+			time.Date(2016, time.August, 2, 0, 0, 0, 0, time.UTC),
+			time.Date(2016, time.August, 3, 0, 0, 0, 0, time.UTC),
+			[]string{
+				"2016/NZ/APIM/LFZ.D/NZ.APIM..LFZ.D.2016.215",
+				"2016/NZ/APIM/LFZ.D/NZ.APIM.50.LFZ.D.2016.215",
+				"2016/NZ/EYWM/LFZ.D/NZ.EYWM.50.LFZ.D.2016.215",
+			},
+		},
+	} {
+		files, err := sdsFiles(root, v.streams, v.start, v.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected []string
+		for _, f := range v.files {
+			expected = append(expected, filepath.Join(root, filepath.FromSlash(f)))
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("%v %s - %s: invalid files, expected %v found %v", v.streams, v.start, v.end, expected, files)
+		}
+	}
+}
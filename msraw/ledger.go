@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	statusProcessed = "processed"
+	statusFailed    = "failed"
+)
+
+// ledgerEntry records the outcome of ingesting an input file.
+type ledgerEntry struct {
+	Path     string     `json:"path"`
+	Size     int64      `json:"size"`
+	ModTime  time.Time  `json:"mtime"`
+	Checksum string     `json:"sha256,omitempty"`
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	Status   string     `json:"status"`
+	Readings int        `json:"readings,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Time     time.Time  `json:"time"`
+}
+
+// ledger is an append only file of json lines, later entries for a path replace earlier ones.
+type ledger struct {
+	path    string
+	entries map[string]ledgerEntry
+
+	// time window readings are kept from, recorded with each entry, zero times leave it open
+	start time.Time
+	end   time.Time
+}
+
+func openLedger(path string) (*ledger, error) {
+	l := &ledger{
+		path:    path,
+		entries: make(map[string]ledgerEntry),
+	}
+
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+		return l, nil
+	case err != nil:
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e ledgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %v", path, n, err)
+		}
+		l.entries[e.Path] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func ledgerKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// lookup returns any entry for the path which matches the current file size and modification time.
+func (l *ledger) lookup(path string, info os.FileInfo) (ledgerEntry, bool) {
+	e, ok := l.entries[ledgerKey(path)]
+	if !ok || e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) {
+		return ledgerEntry{}, false
+	}
+	return e, true
+}
+
+// unchanged checks whether the path was successfully processed with the same size, modification time and checksum.
+func (l *ledger) unchanged(path string, info os.FileInfo, sum string) bool {
+	e, ok := l.lookup(path, info)
+	return ok && e.Status == statusProcessed && e.Checksum == sum
+}
+
+// covered checks whether the window recorded for the path includes the whole of the current window,
+// so nothing outside the readings previously stored would now be kept.
+func (l *ledger) covered(path string) bool {
+	e, ok := l.entries[ledgerKey(path)]
+	switch {
+	case !ok:
+		return false
+	case e.Start != nil && (l.start.IsZero() || l.start.Before(*e.Start)):
+		return false
+	case e.End != nil && (l.end.IsZero() || l.end.After(*e.End)):
+		return false
+	default:
+		return true
+	}
+}
+
+// seen checks whether the ledger holds any entry for the path.
+func (l *ledger) seen(path string) bool {
+	_, ok := l.entries[ledgerKey(path)]
+	return ok
+}
+
+// checksum returns the hex encoded sha256 sum of a file's contents.
+func checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// record appends an entry and syncs the ledger to disk.
+func (l *ledger) record(path string, info os.FileInfo, sum, status string, readings int, failure error) error {
+	e := ledgerEntry{
+		Path:     ledgerKey(path),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Checksum: sum,
+		Status:   status,
+		Readings: readings,
+		Time:     time.Now().UTC(),
+	}
+	if !l.start.IsZero() {
+		start := l.start.UTC()
+		e.Start = &start
+	}
+	if !l.end.IsZero() {
+		end := l.end.UTC()
+		e.End = &end
+	}
+	if failure != nil {
+		e.Error = failure.Error()
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	l.entries[e.Path] = e
+
+	return nil
+}
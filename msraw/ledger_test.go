@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testRecord checksums a file and records it as processed.
+func testRecord(t *testing.T, l *ledger, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := checksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.record(path, info, sum, statusProcessed, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testUnchanged checks whether the ledger holds the file as processed and unchanged.
+func testUnchanged(t *testing.T, l *ledger, path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := checksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l.unchanged(path, info, sum)
+}
+
+func TestLedger_Modified(t *testing.T) {
+
+	dir := t.TempDir()
+	path, input := filepath.Join(dir, "test.ledger"), filepath.Join(dir, "input.mseed")
+
+	if err := os.WriteFile(input, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := openLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.seen(input) {
+		t.Fatal("unexpected entry in an empty ledger")
+	}
+	testRecord(t, l, input)
+
+	// entries survive a restart
+	if l, err = openLedger(path); err != nil {
+		t.Fatal(err)
+	}
+	if !testUnchanged(t, l, input) {
+		t.Error("expected the recorded file to be unchanged")
+	}
+
+	// the same size and modification time with different contents is still a change
+	info, err := os.Stat(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(input, []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(input, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if testUnchanged(t, l, input) {
+		t.Error("expected a change of contents to be found")
+	}
+
+	if err := os.WriteFile(input, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if testUnchanged(t, l, input) {
+		t.Error("expected a modified file to be found")
+	}
+	if !l.seen(input) {
+		t.Error("expected a modified file to have been seen")
+	}
+
+	// recording it again replaces the earlier entry
+	testRecord(t, l, input)
+	if l, err = openLedger(path); err != nil {
+		t.Fatal(err)
+	}
+	if !testUnchanged(t, l, input) {
+		t.Error("expected the file to be unchanged once recorded again")
+	}
+}
+
+func TestLedger_Window(t *testing.T) {
+
+	day := time.Date(2016, time.August, 2, 0, 0, 0, 0, time.UTC)
+
+	dir := t.TempDir()
+	path, input := filepath.Join(dir, "test.ledger"), filepath.Join(dir, "input.mseed")
+
+	if err := os.WriteFile(input, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := openLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.start, l.end = day.Add(6*time.Hour), day.Add(12*time.Hour)
+	testRecord(t, l, input)
+
+	for _, v := range []struct {
+		start, end time.Time
+		covered    bool
+	}{
+		{day.Add(6 * time.Hour), day.Add(12 * time.Hour), true},
+		{day.Add(8 * time.Hour), day.Add(10 * time.Hour), true},
+		{day, day.Add(12 * time.Hour), false},
+		{day.Add(6 * time.Hour), day.Add(24 * time.Hour), false},
+		{time.Time{}, time.Time{}, false},
+	} {
+		l, err := openLedger(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.start, l.end = v.start, v.end
+		if !testUnchanged(t, l, input) {
+			t.Errorf("%s - %s: expected the file to be unchanged", v.start, v.end)
+		}
+		if c := l.covered(input); c != v.covered {
+			t.Errorf("%s - %s: invalid window check, expected %v found %v", v.start, v.end, v.covered, c)
+		}
+	}
+
+	// a file stored without a window covers any window
+	l, err = openLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRecord(t, l, input)
+	l.start, l.end = day, day.Add(24*time.Hour)
+	if !l.covered(input) {
+		t.Error("expected a file stored without a window to cover any window")
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ozym/raw"
+	"github.com/ozym/raw/internal/output"
 )
 
 func main() {
@@ -13,8 +20,8 @@ func main() {
 	var dir string
 	flag.StringVar(&dir, "dir", ".", "output base directory")
 
-	var tmpl string
-	flag.StringVar(&tmpl, "template", "{{Year .Epoch}}/{{Year .Epoch}}.{{Doy .Epoch}}/{{Year .Epoch}}.{{Doy .Epoch}}.{{Hour .Epoch}}.{{.Source}}.csv", "file name template")
+	var out output.Flags
+	out.Register(flag.CommandLine)
 
 	var scale float64
 	flag.Float64Var(&scale, "scale", 1.0, "stream scale factor")
@@ -22,38 +29,208 @@ func main() {
 	var offset float64
 	flag.Float64Var(&offset, "offset", 0.0, "stream offset factor")
 
-	var dp int
-	flag.IntVar(&dp, "dp", -1, "decimal places")
+	// input discovery options
+	var recursive bool
+	flag.BoolVar(&recursive, "recursive", false, "read files found in any directories given")
+	var include list
+	flag.Var(&include, "include", "only read files with names matching these globs (repeatable)")
+	var exclude list
+	flag.Var(&exclude, "exclude", "skip files with names matching these globs (repeatable)")
+
+	// sds archive options
+	var sds string
+	flag.StringVar(&sds, "sds", "", "provide an SDS archive to read day files from, using -streams, -start and -end")
+	var streams list
+	flag.Var(&streams, "streams", "stream patterns to read from an SDS archive, as NET_STA_LOC_CHA globs (repeatable)")
+	var starttime string
+	flag.StringVar(&starttime, "start", "", "start of the time window to read from an SDS archive")
+	var endtime string
+	flag.StringVar(&endtime, "end", "", "end of the time window to read from an SDS archive, defaults to now")
+
+	// resume options
+	var resume bool
+	flag.BoolVar(&resume, "resume", false, "record each stored input file in the ledger and skip any already stored and unchanged")
+
+	// watch options
+	var watch bool
+	flag.BoolVar(&watch, "watch", false, "watch the directories given as arguments for new files rather than reading files")
+	var pattern string
+	flag.StringVar(&pattern, "pattern", "", "only ingest watched files with names matching this glob")
+	var processed string
+	flag.StringVar(&processed, "processed", "", "provide a directory to move ingested files into")
+	var failed string
+	flag.StringVar(&failed, "failed", "", "provide a directory to move files which could not be ingested into")
+	var ledgerfile string
+	flag.StringVar(&ledgerfile, "ledger", "msraw.ledger", "provide a file recording which input files have been ingested, used with -watch and -resume")
+	var settle time.Duration
+	flag.DurationVar(&settle, "settle", 10.0*time.Second, "how long a watched file must be unchanged before it is considered complete")
+	var poll time.Duration
+	flag.DurationVar(&poll, "poll", 30.0*time.Second, "how often to scan watched directories")
 
 	flag.Parse()
 
-	storage, err := raw.NewTemplate(tmpl)
+	storage, err := out.Output(flag.CommandLine)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var readings []raw.Reading
-	for _, infile := range flag.Args() {
-		switch infile {
-		case "-":
+	if watch {
+		l, err := openLedger(ledgerfile)
+		if err != nil {
+			log.Fatalf("unable to open ledger: %v", err)
+		}
+
+		// handle process signals via the context
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		w := &watcher{
+			dirs:      flag.Args(),
+			pattern:   pattern,
+			settle:    settle,
+			poll:      poll,
+			processed: processed,
+			failed:    failed,
+			ledger:    l,
+			ingest: func(path string) (int, error) {
+				r, err := raw.ReadMSeedFile(path, offset, scale)
+				if err != nil {
+					return 0, err
+				}
+				if err := storage.Store(dir, r); err != nil {
+					return 0, err
+				}
+				return len(r), nil
+			},
+			pending: make(map[string]pending),
+		}
+
+		log.Printf("watching: %s", strings.Join(w.dirs, ","))
+		if err := w.run(ctx); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("terminated")
+
+		return
+	}
+
+	var start, end time.Time
+	var infiles []string
+	switch {
+	case sds != "":
+		if starttime == "" {
+			log.Fatal("an SDS archive requires a start time")
+		}
+		if start, err = parseTime(starttime); err != nil {
+			log.Fatal(err)
+		}
+		end = time.Now().UTC()
+		if endtime != "" {
+			if end, err = parseTime(endtime); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if infiles, err = sdsFiles(sds, streams, start, end); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("found %d day files: %s", len(infiles), sds)
+	default:
+		if infiles, err = expand(flag.Args(), recursive, include, exclude); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var l *ledger
+	if resume {
+		if l, err = openLedger(ledgerfile); err != nil {
+			log.Fatalf("unable to open ledger: %v", err)
+		}
+		// readings outside the window were never stored, so a wider window needs the files again
+		if sds != "" {
+			l.start, l.end = start, end
+		}
+	}
+
+	// each input is stored before the next is read so progress can be recorded
+	store := func(readings []raw.Reading) error {
+		if sds != "" {
+			readings = window(readings, start, end)
+		}
+		log.Printf("storing %d readings: %s", len(readings), dir)
+		return storage.Store(dir, readings)
+	}
+
+	var sum summary
+	for _, infile := range infiles {
+		if infile == "-" {
 			log.Println("reading: stdin")
 			r, err := raw.ReadMSeedStream(os.Stdin, offset, scale)
 			if err != nil {
 				log.Fatal(err)
 			}
-			readings = append(readings, r...)
-		default:
-			log.Printf("reading: %s", infile)
-			r, err := raw.ReadMSeedFile(infile, offset, scale)
-			if err != nil {
+			if err := store(r); err != nil {
 				log.Fatal(err)
 			}
-			readings = append(readings, r...)
+			sum.processed++
+			sum.readings += len(r)
+			continue
 		}
-	}
 
-	log.Printf("storing %d readings: %s", len(readings), dir)
-	if err := raw.Store(dir, raw.NewCsv(dp), storage.Execute, readings); err != nil {
-		log.Fatal(err)
+		info, err := os.Stat(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var hash string
+		if l != nil {
+			if hash, err = checksum(infile); err != nil {
+				log.Fatal(err)
+			}
+			switch {
+			case l.unchanged(infile, info, hash) && l.covered(infile):
+				log.Printf("skipping unchanged: %s", infile)
+				sum.skipped++
+				continue
+			case l.unchanged(infile, info, hash):
+				log.Printf("reprocessing for a wider time window: %s", infile)
+				sum.widened++
+			case l.seen(infile):
+				log.Printf("reprocessing modified: %s", infile)
+				sum.modified++
+			}
+		}
+
+		log.Printf("reading: %s", infile)
+		r, err := raw.ReadMSeedFile(infile, offset, scale)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := store(r); err != nil {
+			log.Fatal(err)
+		}
+		sum.processed++
+		sum.readings += len(r)
+
+		if l != nil {
+			if err := l.record(infile, info, hash, statusProcessed, len(r), nil); err != nil {
+				log.Fatalf("unable to update ledger: %v", err)
+			}
+		}
 	}
+
+	log.Printf("done: %s", sum)
+}
+
+// summary counts the work done by a batch run.
+type summary struct {
+	processed int
+	modified  int
+	widened   int
+	skipped   int
+	readings  int
+}
+
+func (s summary) String() string {
+	return fmt.Sprintf("%d files processed (%d modified since a previous run, %d for a wider time window), %d unchanged files skipped, %d readings stored",
+		s.processed, s.modified, s.widened, s.skipped, s.readings)
 }
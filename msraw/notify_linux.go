@@ -0,0 +1,74 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// notify reports files in the given directories which have been closed after writing or moved into place.
+func notify(ctx context.Context, dirs []string) (<-chan string, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	watches := make(map[int32]string)
+	for _, dir := range dirs {
+		wd, err := syscall.InotifyAddWatch(fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+		watches[int32(wd)] = dir
+	}
+
+	// a non-blocking file uses the runtime poller, so closing it interrupts any pending read
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	paths := make(chan string)
+	go func() {
+		defer close(paths)
+
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				name := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(ev.Len)]
+				offset += syscall.SizeofInotifyEvent + int(ev.Len)
+
+				dir, ok := watches[ev.Wd]
+				if !ok || ev.Len == 0 {
+					continue
+				}
+				for i, c := range name {
+					if c == 0 {
+						name = name[:i]
+						break
+					}
+				}
+
+				select {
+				case paths <- filepath.Join(dir, string(name)):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return paths, nil
+}
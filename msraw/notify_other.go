@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// notify is only available on linux, other systems rely on polling.
+func notify(ctx context.Context, dirs []string) (<-chan string, error) {
+	return nil, fmt.Errorf("file notifications are not supported")
+}
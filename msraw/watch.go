@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type pending struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// watcher ingests files arriving in a set of directories, a file is considered complete once its
+// size and modification time have not changed for the settle period. Notifications of files closed
+// after writing or moved into place only start the settle period sooner than a scan would.
+type watcher struct {
+	dirs    []string
+	pattern string
+
+	settle time.Duration
+	poll   time.Duration
+
+	// optional destinations for ingested and rejected files
+	processed string
+	failed    string
+
+	ledger *ledger
+	ingest func(string) (int, error)
+
+	pending map[string]pending
+}
+
+func (w *watcher) run(ctx context.Context) error {
+	for _, d := range []string{w.processed, w.failed} {
+		if d == "" {
+			continue
+		}
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+
+	complete, err := notify(ctx, w.dirs)
+	if err != nil {
+		log.Printf("watch: unable to use file notifications, polling: %v", err)
+	}
+
+	interval := w.poll
+	if w.settle > 0 && w.settle < interval {
+		interval = w.settle
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	w.scan()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case path, ok := <-complete:
+			if !ok {
+				complete = nil
+				continue
+			}
+			if !w.match(path) {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && w.observe(path, info) {
+				w.handle(path, info)
+			}
+		case <-tick.C:
+			w.scan()
+		}
+	}
+}
+
+func (w *watcher) match(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	if w.pattern == "" {
+		return true
+	}
+	ok, _ := filepath.Match(w.pattern, name)
+	return ok
+}
+
+// scan looks for files which have settled.
+func (w *watcher) scan() {
+	seen := make(map[string]bool)
+	for _, dir := range w.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("watch: unable to read directory %s: %v", dir, err)
+			continue
+		}
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+			if !w.match(path) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			seen[path] = true
+
+			if w.observe(path, info) {
+				w.handle(path, info)
+			}
+		}
+	}
+
+	for k := range w.pending {
+		if !seen[k] {
+			delete(w.pending, k)
+		}
+	}
+}
+
+// observe records a file's size and modification time, restarting its settle period whenever either
+// changes. It reports whether the file is ready to be handled, either settled or already in the ledger.
+func (w *watcher) observe(path string, info os.FileInfo) bool {
+	p, ok := w.pending[path]
+	if !ok || p.size != info.Size() || !p.modTime.Equal(info.ModTime()) {
+		w.pending[path] = pending{size: info.Size(), modTime: info.ModTime(), since: time.Now()}
+		_, done := w.ledger.lookup(path, info)
+		return done
+	}
+	return time.Since(p.since) >= w.settle
+}
+
+// handle ingests a complete file, unless the ledger shows it has already been dealt with, and
+// then moves it to the processed or failed directory.
+func (w *watcher) handle(path string, info os.FileInfo) {
+	delete(w.pending, path)
+
+	e, done := w.ledger.lookup(path, info)
+	if !done {
+		log.Printf("reading: %s", path)
+
+		sum, err := checksum(path)
+		if err != nil {
+			log.Printf("unable to read %s: %v", path, err)
+			return
+		}
+
+		n, err := w.ingest(path)
+		status := statusProcessed
+		if err != nil {
+			log.Printf("unable to ingest %s: %v", path, err)
+			status = statusFailed
+		} else {
+			log.Printf("stored %d readings: %s", n, path)
+		}
+		if err := w.ledger.record(path, info, sum, status, n, err); err != nil {
+			log.Printf("unable to update ledger: %v", err)
+			return
+		}
+		e, _ = w.ledger.lookup(path, info)
+	}
+
+	dest := w.processed
+	if e.Status == statusFailed {
+		dest = w.failed
+	}
+	if dest == "" {
+		return
+	}
+
+	target, err := uniquePath(filepath.Join(dest, filepath.Base(path)))
+	if err != nil {
+		log.Printf("unable to move %s: %v", path, err)
+		return
+	}
+	if err := os.Rename(path, target); err != nil {
+		log.Printf("unable to move %s: %v", path, err)
+	}
+}
+
+// uniquePath avoids overwriting an existing file by adding a numeric suffix.
+func uniquePath(path string) (string, error) {
+	for n := 0; n < 1000; n++ {
+		p := path
+		if n > 0 {
+			p = fmt.Sprintf("%s.%d", path, n)
+		}
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no unused name for %s", path)
+}
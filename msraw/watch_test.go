@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWatcher watches a temporary directory, failing to ingest any file whose name contains "bad".
+func testWatcher(t *testing.T, settle time.Duration) (*watcher, *[]string) {
+	dir := t.TempDir()
+
+	l, err := openLedger(filepath.Join(dir, "test.ledger"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var ingested []string
+
+	w := &watcher{
+		dirs:      []string{filepath.Join(dir, "incoming")},
+		settle:    settle,
+		poll:      time.Hour,
+		processed: filepath.Join(dir, "processed"),
+		failed:    filepath.Join(dir, "failed"),
+		ledger:    l,
+		ingest: func(path string) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			ingested = append(ingested, filepath.Base(path))
+			if strings.Contains(path, "bad") {
+				return 0, errors.New("invalid miniseed")
+			}
+			return 10, nil
+		},
+		pending: make(map[string]pending),
+	}
+	for _, d := range []string{w.dirs[0], w.processed, w.failed} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return w, &ingested
+}
+
+func testExists(t *testing.T, path string) bool {
+	_, err := os.Stat(path)
+	switch {
+	case err == nil:
+		return true
+	case os.IsNotExist(err):
+		return false
+	default:
+		t.Fatal(err)
+	}
+	return false
+}
+
+func TestWatcher_Scan(t *testing.T) {
+
+	w, ingested := testWatcher(t, 200*time.Millisecond)
+	incoming := w.dirs[0]
+
+	for _, n := range []string{"good.mseed", "bad.mseed", ".partial.mseed"} {
+		if err := os.WriteFile(filepath.Join(incoming, n), []byte(n), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// new files wait for the settle period
+	w.scan()
+	if len(*ingested) != 0 {
+		t.Fatalf("unexpected ingest before files settled: %v", *ingested)
+	}
+
+	// a file which changes starts again
+	time.Sleep(120 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(incoming, "good.mseed"), []byte("more data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.scan()
+	time.Sleep(120 * time.Millisecond)
+	w.scan()
+	if strings.Join(*ingested, ",") != "bad.mseed" {
+		t.Errorf("invalid ingested files, expected bad.mseed found %v", *ingested)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	w.scan()
+	if strings.Join(*ingested, ",") != "bad.mseed,good.mseed" {
+		t.Errorf("invalid ingested files, expected bad.mseed,good.mseed found %v", *ingested)
+	}
+
+	if !testExists(t, filepath.Join(w.processed, "good.mseed")) {
+		t.Error("expected good.mseed to be moved into the processed directory")
+	}
+	if !testExists(t, filepath.Join(w.failed, "bad.mseed")) {
+		t.Error("expected bad.mseed to be moved into the failed directory")
+	}
+	if !testExists(t, filepath.Join(incoming, ".partial.mseed")) {
+		t.Error("expected hidden files to be left alone")
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("expected nothing pending, found %d files", len(w.pending))
+	}
+
+	for k, v := range map[string]string{"good.mseed": statusProcessed, "bad.mseed": statusFailed} {
+		e, ok := w.ledger.entries[ledgerKey(filepath.Join(incoming, k))]
+		if !ok || e.Status != v {
+			t.Errorf("%s: invalid ledger status, expected %s found %q", k, v, e.Status)
+		}
+	}
+}
+
+func TestWatcher_Handle(t *testing.T) {
+
+	w, ingested := testWatcher(t, time.Hour)
+	incoming := w.dirs[0]
+
+	path := filepath.Join(incoming, "data.mseed")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a name already in the processed directory is kept
+	if err := os.WriteFile(filepath.Join(w.processed, "data.mseed"), []byte("earlier"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.handle(path, info)
+	if !testExists(t, filepath.Join(w.processed, "data.mseed.1")) {
+		t.Error("expected the file to be moved alongside the earlier one")
+	}
+
+	// a file already in the ledger, e.g. left behind when moving it failed, is moved without ingesting it again
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	w.scan()
+	if len(*ingested) != 1 {
+		t.Errorf("expected a single ingest, found %v", *ingested)
+	}
+	if !testExists(t, filepath.Join(w.processed, "data.mseed.2")) {
+		t.Error("expected the recorded file to be moved without waiting to settle")
+	}
+}
+
+func TestWatcher_Run(t *testing.T) {
+
+	settle := 200 * time.Millisecond
+	w, _ := testWatcher(t, settle)
+
+	done := make(chan time.Time, 1)
+	ingest := w.ingest
+	w.ingest = func(path string) (int, error) {
+		done <- time.Now()
+		return ingest(path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- w.run(ctx)
+	}()
+
+	// notifications of a closed file don't bypass the settle period
+	time.Sleep(50 * time.Millisecond)
+	written := time.Now()
+	if err := os.WriteFile(filepath.Join(w.dirs[0], "data.mseed"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case at := <-done:
+		if at.Sub(written) < settle {
+			t.Errorf("file ingested after %s, before the %s settle period", at.Sub(written), settle)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file was not ingested")
+	}
+
+	cancel()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
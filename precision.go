@@ -0,0 +1,145 @@
+package raw
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Precision modes, shortest uses the fewest digits which read back as the same value.
+const (
+	PrecisionShortest = "shortest"
+	PrecisionFixed    = "fixed"
+	PrecisionSig      = "sig"
+)
+
+// Precision describes how values are formatted, either with a fixed number of decimal
+// places or rounded to a number of significant figures.
+type Precision struct {
+	Mode   string
+	Digits int
+}
+
+// Format returns the canonical text of a value, formatting the parsed text again gives the
+// same result so that unchanged files compare equal.
+func (p Precision) Format(v float64) string {
+	var s string
+	switch {
+	case math.IsNaN(v), math.IsInf(v, 0):
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case p.Mode == PrecisionFixed:
+		s = strconv.FormatFloat(v, 'f', p.Digits, 64)
+	case p.Mode == PrecisionSig && p.Digits > 0:
+		x, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'e', p.Digits-1, 64), 64)
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	default:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	// avoid a negative zero after rounding
+	if strings.HasPrefix(s, "-") && strings.Trim(s, "-0.") == "" {
+		s = s[1:]
+	}
+
+	return s
+}
+
+func (p Precision) String() string {
+	switch p.Mode {
+	case PrecisionFixed, PrecisionSig:
+		return fmt.Sprintf("%s:%d", p.Mode, p.Digits)
+	default:
+		return PrecisionShortest
+	}
+}
+
+// DecimalPrecision converts a decimal place setting, negative values give the shortest formatting.
+func DecimalPrecision(dp int) Precision {
+	if dp < 0 {
+		return Precision{Mode: PrecisionShortest}
+	}
+	return Precision{Mode: PrecisionFixed, Digits: dp}
+}
+
+// ParsePrecision decodes "shortest", "fixed:N" or "sig:N", a plain number is taken as fixed decimal places.
+func ParsePrecision(s string) (Precision, error) {
+	mode, digits := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		mode, digits = s[:i], s[i+1:]
+	}
+
+	if n, err := strconv.Atoi(mode); err == nil && digits == "" {
+		return DecimalPrecision(n), nil
+	}
+
+	switch mode = strings.ToLower(mode); mode {
+	case PrecisionShortest:
+		if digits != "" {
+			return Precision{}, fmt.Errorf("invalid precision, shortest takes no digits: %s", s)
+		}
+		return Precision{Mode: mode}, nil
+	case PrecisionFixed, PrecisionSig:
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 0 || (mode == PrecisionSig && n < 1) || n > 17 {
+			return Precision{}, fmt.Errorf("invalid precision digits: %s", s)
+		}
+		return Precision{Mode: mode, Digits: n}, nil
+	default:
+		return Precision{}, fmt.Errorf("invalid precision mode: %s", s)
+	}
+}
+
+// PrecisionRule applies a precision to streams matching a source glob, e.g. "NZ_*_*_LK?".
+type PrecisionRule struct {
+	Pattern   string
+	Precision Precision
+}
+
+// PrecisionRules are checked in order, the first matching rule is used.
+type PrecisionRules []PrecisionRule
+
+// ParsePrecisionRules decodes a comma separated list of GLOB=PRECISION rules.
+func ParsePrecisionRules(s string) (PrecisionRules, error) {
+	var rules PrecisionRules
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		i := strings.LastIndex(r, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid precision rule, expected GLOB=PRECISION: %s", r)
+		}
+		if _, err := path.Match(r[:i], ""); err != nil {
+			return nil, fmt.Errorf("invalid precision rule pattern: %s", r[:i])
+		}
+		p, err := ParsePrecision(r[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, PrecisionRule{Pattern: r[:i], Precision: p})
+	}
+	return rules, nil
+}
+
+// Select returns the precision for a source, from the first matching rule or otherwise the decimal places.
+func (r PrecisionRules) Select(source string, dp *int) Precision {
+	if p, ok := r.Lookup(source); ok {
+		return p
+	}
+	if dp != nil {
+		return DecimalPrecision(*dp)
+	}
+	return DecimalPrecision(-1)
+}
+
+// Lookup finds the precision for a source.
+func (r PrecisionRules) Lookup(source string) (Precision, bool) {
+	for _, x := range r {
+		if ok, _ := path.Match(x.Pattern, source); ok {
+			return x.Precision, true
+		}
+	}
+	return Precision{}, false
+}
@@ -0,0 +1,87 @@
+package raw
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPrecision_Format(t *testing.T) {
+
+	var tests = []struct {
+		p string
+		v float64
+		s string
+	}{
+		{"shortest", 0.30000000000000004, "0.30000000000000004"},
+		{"fixed:2", 0.30000000000000004, "0.30"},
+		{"2", -41221.256, "-41221.26"},
+		{"-1", 12.5, "12.5"},
+		{"fixed:0", -0.2, "0"},
+		{"fixed:2", -0.001, "0.00"},
+		{"sig:3", 41221.5, "41200"},
+		{"sig:3", 0.000123456, "0.000123"},
+		{"sig:7", 0.30000000000000004, "0.3"},
+		{"sig:2", -0.0004, "-0.0004"},
+	}
+
+	for _, x := range tests {
+		p, err := ParsePrecision(x.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := p.Format(x.v)
+		if s != x.s {
+			t.Errorf("invalid %s formatting of %g, expected %q found %q", x.p, x.v, x.s, s)
+		}
+
+		// formatting should be stable across reads and writes
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again := p.Format(v); again != s {
+			t.Errorf("unstable %s formatting of %g, expected %q found %q", x.p, x.v, s, again)
+		}
+	}
+
+	for _, s := range []string{"fixed", "sig:0", "sig:x", "round:2", "shortest:2"} {
+		if _, err := ParsePrecision(s); err == nil {
+			t.Errorf("expected an error parsing precision %q", s)
+		}
+	}
+}
+
+func TestPrecision_Rules(t *testing.T) {
+
+	rules, err := ParsePrecisionRules("NZ_*_*_LK?=fixed:1, NZ_*=sig:6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LKO", at, 12.3456},
+		{"NZ_APIM_50_LFZ", at, -41221.256},
+		{"AU_CNB_00_LFZ", at, 1.23456},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Csv{DecimalPlace: new(int), Precision: rules}, readings); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `2016-08-02T04:00:00Z,NZ_APIM_50_LKO,12.3
+2016-08-02T04:00:00Z,NZ_APIM_50_LFZ,-41221.3
+2016-08-02T04:00:00Z,AU_CNB_00_LFZ,1
+`
+	if buf.String() != expected {
+		t.Errorf("invalid csv output, expected:\n%s\nfound:\n%s", expected, buf.String())
+	}
+
+	if _, err := ParsePrecisionRules("NZ_*"); err == nil {
+		t.Error("expected an error for a rule without a precision")
+	}
+}
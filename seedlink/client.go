@@ -0,0 +1,476 @@
+package seedlink
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTimeout = errors.New("seedlink network timeout")
+
+var errRecheck = errors.New("checking higher priority servers")
+
+type Packet struct {
+	Sequence int
+	Header   Header
+	Record   []byte
+}
+
+type Client struct {
+	// server addresses in priority order
+	Servers []string
+
+	// network timeout, reconnect delay and idle keep-alive interval
+	NetTo     time.Duration
+	NetDly    time.Duration
+	KeepAlive time.Duration
+
+	// the reconnect delay doubles after each failure to reach any server up to this limit
+	MaxDly time.Duration
+
+	// how often to try higher priority servers after a failover, zero to stay connected
+	Recheck time.Duration
+
+	// time window used for streams without a sequence number
+	Begin time.Time
+	End   time.Time
+
+	// use FETCH rather than DATA, the collection finishes once the server is drained
+	Fetch bool
+
+	// optional logging of connection events
+	Logf func(string, ...interface{})
+
+	// optional notification of each failed or dropped connection, rechecks are not failures
+	OnError func(string, error)
+
+	mu      sync.Mutex
+	streams []Stream
+}
+
+func NewClient(servers []string, streams []Stream) *Client {
+	return &Client{
+		Servers: append([]string{}, servers...),
+		NetTo:   300 * time.Second,
+		NetDly:  30 * time.Second,
+		MaxDly:  600 * time.Second,
+		streams: append([]Stream{}, streams...),
+	}
+}
+
+func (c *Client) Streams() []Stream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Stream{}, c.streams...)
+}
+
+func (c *Client) SetStreams(streams []Stream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.streams = append([]Stream{}, streams...)
+}
+
+func (c *Client) SaveState(path string) error {
+	return WriteStateFile(path, NewState(c.Streams()))
+}
+
+// RecoverState applies a stored state, either JSON or the legacy libslink format, to the client streams.
+func (c *Client) RecoverState(path string) error {
+	state, err := ReadStateFile(path)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state.Apply(c.streams)
+
+	return nil
+}
+
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, v...)
+	}
+}
+
+// Update records a packet as the resume position of its stream, Collect calls it for each packet received.
+func (c *Client) Update(addr string, p Packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.streams {
+		if c.streams[i].Match(p.Header.Network, p.Header.Station) {
+			c.streams[i].Server, c.streams[i].Sequence, c.streams[i].Timestamp = addr, p.Sequence, p.Header.EndTime()
+			break
+		}
+	}
+}
+
+// Collect passes each received data packet to the given function until the context is
+// cancelled, the function returns an error, or a fetch request is complete. Servers are
+// tried in priority order after network timeouts or errors, with the reconnect delay
+// backing off exponentially whenever none of them can be reached.
+func (c *Client) Collect(ctx context.Context, fn func(Packet) error) error {
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("no seedlink servers given")
+	}
+
+	var active string
+
+	delay := c.NetDly
+	for {
+		var received, recheck bool
+		for n, addr := range c.Servers {
+			ok, err := c.collect(ctx, addr, c.Servers[:n], fn, func() {
+				if active != "" && active != addr {
+					c.logf("seedlink failover: %s -> %s", active, addr)
+				}
+				active = addr
+			})
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case err == nil:
+				return nil
+			case errors.Is(err, errCallback):
+				return errors.Unwrap(err)
+			}
+
+			c.logf("seedlink %s: %v", addr, err)
+			if c.OnError != nil && err != errRecheck {
+				c.OnError(addr, err)
+			}
+
+			// start again from the highest priority server
+			if received, recheck = ok, err == errRecheck; received || recheck {
+				break
+			}
+		}
+
+		if recheck {
+			continue
+		}
+
+		switch {
+		case received:
+			delay = c.NetDly
+		case delay < c.NetDly:
+			delay = c.NetDly
+		}
+
+		c.logf("seedlink: reconnecting in %s", delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if !received {
+			if delay *= 2; c.MaxDly > 0 && delay > c.MaxDly {
+				delay = c.MaxDly
+			}
+		}
+	}
+}
+
+var errCallback = errors.New("callback")
+
+type callbackError struct {
+	err error
+}
+
+func (e callbackError) Error() string        { return e.err.Error() }
+func (e callbackError) Unwrap() error        { return e.err }
+func (e callbackError) Is(target error) bool { return target == errCallback }
+
+type frame struct {
+	packet Packet
+	info   bool
+	end    bool
+}
+
+// probeTimeout limits how long a recheck waits on a higher priority server before staying with a backup.
+const probeTimeout = 5 * time.Second
+
+// reachable checks whether any of the servers accepts a connection.
+func (c *Client) reachable(ctx context.Context, servers []string) bool {
+	d := net.Dialer{Timeout: probeTimeout}
+	if c.NetTo > 0 && c.NetTo < d.Timeout {
+		d.Timeout = c.NetTo
+	}
+	for _, addr := range servers {
+		if conn, err := d.DialContext(ctx, "tcp", addr); err == nil {
+			conn.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// collect reads packets from a single server connection, it reports whether any data was received. Any
+// higher priority servers are probed every recheck interval and the connection is dropped once one is reachable.
+func (c *Client) collect(ctx context.Context, addr string, higher []string, fn func(Packet) error, connected func()) (bool, error) {
+	var d net.Dialer
+	if c.NetTo > 0 {
+		d.Timeout = c.NetTo
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// unblock any pending reads on cancellation
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	rd := bufio.NewReader(conn)
+	if err := c.negotiate(conn, rd, addr); err != nil {
+		return false, err
+	}
+
+	frames, errs := make(chan frame), make(chan error, 1)
+	go func() {
+		for {
+			f, err := readFrame(rd)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case frames <- f:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	interval := time.Second
+	for _, d := range []time.Duration{c.NetTo, c.KeepAlive} {
+		if d > 0 && d/4 < interval {
+			interval = d / 4
+		}
+	}
+	check := time.NewTicker(interval)
+	defer check.Stop()
+
+	var received, probing bool
+
+	// the probe runs in the background so that packets keep flowing
+	probe := make(chan bool, 1)
+
+	start, last, alive := time.Now(), time.Now(), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return received, ctx.Err()
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return received, ctx.Err()
+			}
+			return received, err
+		case <-check.C:
+			if c.NetTo > 0 && time.Since(last) > c.NetTo {
+				return received, ErrTimeout
+			}
+			if len(higher) > 0 && c.Recheck > 0 && time.Since(start) > c.Recheck && !probing {
+				probing = true
+				go func() {
+					probe <- c.reachable(ctx, higher)
+				}()
+			}
+			if c.KeepAlive > 0 && time.Since(last) > c.KeepAlive && time.Since(alive) > c.KeepAlive {
+				if err := command(conn, "INFO ID"); err != nil {
+					return received, err
+				}
+				alive = time.Now()
+			}
+		case ok := <-probe:
+			if ok {
+				return received, errRecheck
+			}
+			c.logf("seedlink %s: higher priority servers unavailable, checking again in %s", addr, c.Recheck)
+			probing, start = false, time.Now()
+		case f := <-frames:
+			last = time.Now()
+
+			switch {
+			case f.end:
+				return received, nil
+			case f.info:
+				continue
+			}
+
+			if !received {
+				connected()
+			}
+			received = true
+
+			c.Update(addr, f.packet)
+			if err := fn(f.packet); err != nil {
+				return received, callbackError{err}
+			}
+		}
+	}
+}
+
+func command(wr io.Writer, cmd string) error {
+	_, err := io.WriteString(wr, cmd+"\r\n")
+	return err
+}
+
+func response(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func expect(conn io.Writer, rd *bufio.Reader, cmd string) error {
+	if err := command(conn, cmd); err != nil {
+		return err
+	}
+	resp, err := response(rd)
+	if err != nil {
+		return err
+	}
+	if resp != "OK" {
+		return fmt.Errorf("command %q rejected: %s", cmd, resp)
+	}
+	return nil
+}
+
+func (c *Client) negotiate(conn net.Conn, rd *bufio.Reader, addr string) error {
+	if c.NetTo > 0 {
+		if err := conn.SetDeadline(time.Now().Add(c.NetTo)); err != nil {
+			return err
+		}
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if err := command(conn, "HELLO"); err != nil {
+		return err
+	}
+	version, err := response(rd)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(version, "SeedLink") {
+		return fmt.Errorf("invalid server response: %s", version)
+	}
+	if _, err := response(rd); err != nil {
+		return err
+	}
+
+	action := "DATA"
+	if c.Fetch {
+		action = "FETCH"
+	}
+
+	for _, s := range c.Streams() {
+		if err := expect(conn, rd, "STATION "+s.Station+" "+s.Network); err != nil {
+			return err
+		}
+		for _, sel := range s.Selectors {
+			if err := expect(conn, rd, "SELECT "+sel); err != nil {
+				return err
+			}
+		}
+
+		// sequence numbers are only meaningful for the server that issued them
+		if s.Server != "" && s.Server != addr {
+			s.Sequence = -1
+		}
+
+		var cmd string
+		switch {
+		case s.Sequence >= 0 && !s.Timestamp.IsZero():
+			cmd = fmt.Sprintf("%s %06X %s", action, (s.Sequence+1)&0xffffff, s.Timestamp.UTC().Format(timestampFormat))
+		case s.Sequence >= 0:
+			cmd = fmt.Sprintf("%s %06X", action, (s.Sequence+1)&0xffffff)
+		case !s.Timestamp.IsZero():
+			cmd = c.window(s.Timestamp)
+		case !c.Begin.IsZero():
+			cmd = c.window(c.Begin)
+		default:
+			cmd = action
+		}
+		if err := expect(conn, rd, cmd); err != nil {
+			return err
+		}
+	}
+
+	return command(conn, "END")
+}
+
+// window builds a time based request, fetch requests are limited to the data currently available.
+func (c *Client) window(begin time.Time) string {
+	end := c.End
+	if end.IsZero() && c.Fetch {
+		end = time.Now()
+	}
+	if end.IsZero() {
+		return "TIME " + begin.UTC().Format(timestampFormat)
+	}
+	return "TIME " + begin.UTC().Format(timestampFormat) + " " + end.UTC().Format(timestampFormat)
+}
+
+func readFrame(rd *bufio.Reader) (frame, error) {
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(rd, head[:3]); err != nil {
+		return frame{}, err
+	}
+
+	switch string(head[:3]) {
+	case "END":
+		return frame{end: true}, nil
+	case "ERR":
+		return frame{}, fmt.Errorf("server error")
+	}
+
+	if _, err := io.ReadFull(rd, head[3:]); err != nil {
+		return frame{}, err
+	}
+
+	record := make([]byte, RecordSize)
+	if _, err := io.ReadFull(rd, record); err != nil {
+		return frame{}, err
+	}
+
+	switch {
+	case strings.HasPrefix(string(head), "SLINFO"):
+		return frame{info: true}, nil
+	case strings.HasPrefix(string(head), "SL"):
+		seq, err := strconv.ParseInt(string(head[2:]), 16, 32)
+		if err != nil {
+			return frame{}, fmt.Errorf("invalid packet sequence: %q", string(head[2:]))
+		}
+		h, err := DecodeHeader(record)
+		if err != nil {
+			return frame{}, err
+		}
+		return frame{packet: Packet{Sequence: int(seq), Header: h, Record: record}}, nil
+	default:
+		return frame{}, fmt.Errorf("invalid packet header: %q", string(head))
+	}
+}
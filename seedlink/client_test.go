@@ -0,0 +1,183 @@
+package seedlink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testLog struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *testLog) Logf(format string, v ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *testLog) Find(prefix string) []string {
+	l.Lock()
+	defer l.Unlock()
+
+	var found []string
+	for _, s := range l.lines {
+		if strings.HasPrefix(s, prefix) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func closedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestClient_Failover(t *testing.T) {
+	server, primary := testServer(t, 50, 0, 0, 0, 0, 0, 0, 0)
+	_, secondary := testServer(t)
+
+	var log testLog
+
+	client := testClient(t, primary, "???")
+	client.Servers, client.Logf = append(client.Servers, secondary), log.Logf
+
+	packets := collect(t, client, 0)
+
+	seen := make(map[string]bool)
+	for _, p := range packets {
+		seen[p.Header.StartTime.String()] = true
+	}
+	if n := len(server.Packets()); len(seen) != n {
+		t.Errorf("invalid number of unique packets, expected %d found %d", n, len(seen))
+	}
+
+	if f := log.Find("seedlink failover: " + primary + " -> " + secondary); len(f) != 1 {
+		t.Errorf("expected a single failover log entry, found %v", f)
+	}
+	for _, s := range client.Streams() {
+		if s.Server != secondary {
+			t.Errorf("invalid stream server, expected %s found %s", secondary, s.Server)
+		}
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	var log testLog
+
+	client := NewClient([]string{closedAddr(t), closedAddr(t)}, []Stream{{Network: "NZ", Station: "APIM", Sequence: -1}})
+	client.NetDly, client.MaxDly, client.Logf = 10*time.Millisecond, 40*time.Millisecond, log.Logf
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	if err := client.Collect(ctx, func(Packet) error { return nil }); err != context.DeadlineExceeded {
+		t.Fatalf("expected a deadline error, found %v", err)
+	}
+
+	delays := log.Find("seedlink: reconnecting in ")
+	if len(delays) < 4 {
+		t.Fatalf("expected at least four reconnect attempts, found %d", len(delays))
+	}
+	for i, d := range []string{"10ms", "20ms", "40ms", "40ms"} {
+		if !strings.HasSuffix(delays[i], " "+d) {
+			t.Errorf("invalid reconnect delay %d, expected %s found %q", i, d, delays[i])
+		}
+	}
+}
+
+func TestClient_Recheck(t *testing.T) {
+	primary := closedAddr(t)
+	server, secondary := testServer(t)
+
+	var log testLog
+
+	client := testClient(t, primary, "???")
+	client.Servers, client.Logf = append(client.Servers, secondary), log.Logf
+	client.Fetch, client.Recheck, client.KeepAlive = false, 50*time.Millisecond, 100*time.Millisecond
+
+	// only the initial failure of the primary is an error, not returning to it
+	var errs int32
+	client.OnError = func(string, error) {
+		atomic.AddInt32(&errs, 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Collect(ctx, func(p Packet) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			seen[p.Header.StartTime.String()] = true
+			return nil
+		})
+	}()
+
+	// the backup is kept while the primary is down
+	time.Sleep(300 * time.Millisecond)
+	if f := log.Find("seedlink " + secondary + ": higher priority servers unavailable"); len(f) < 2 {
+		t.Errorf("expected repeated rechecks of the primary, found %v", f)
+	}
+	if f := log.Find("seedlink " + secondary + ": " + errRecheck.Error()); len(f) != 0 {
+		t.Errorf("unexpected drop of the backup connection: %v", f)
+	}
+
+	// and dropped once it returns
+	l, err := net.Listen("tcp", primary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewServer()
+	if err := restored.AddFile(testFile); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		restored.Serve(ctx, l)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(log.Find("seedlink failover: "+secondary+" -> "+primary)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a failover back to the primary")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected a cancelled collection, found %v", err)
+	}
+	<-served
+
+	if n := atomic.LoadInt32(&errs); n != 1 {
+		t.Errorf("invalid number of connection errors, expected %d found %d", 1, n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if n := len(server.Packets()); len(seen) != n {
+		t.Errorf("invalid number of unique packets, expected %d found %d", n, len(seen))
+	}
+}
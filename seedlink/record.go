@@ -0,0 +1,113 @@
+package seedlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const RecordSize = 512
+
+const headerSize = 48
+
+type Header struct {
+	SequenceNumber string
+	Network        string
+	Station        string
+	Location       string
+	Channel        string
+	StartTime      time.Time
+	Samples        int
+	SampleRate     float64
+}
+
+func DecodeHeader(buf []byte) (Header, error) {
+	if len(buf) < headerSize {
+		return Header{}, fmt.Errorf("short miniseed header: %d bytes", len(buf))
+	}
+
+	// guess the byte order from the year
+	var order binary.ByteOrder = binary.BigEndian
+	if y := order.Uint16(buf[20:22]); y < 1900 || y > 2100 {
+		order = binary.LittleEndian
+	}
+	if y := order.Uint16(buf[20:22]); y < 1900 || y > 2100 {
+		return Header{}, fmt.Errorf("invalid miniseed header year: %d", y)
+	}
+
+	start := time.Date(
+		int(order.Uint16(buf[20:22])),
+		time.January,
+		int(order.Uint16(buf[22:24])),
+		int(buf[24]),
+		int(buf[25]),
+		int(buf[26]),
+		int(order.Uint16(buf[28:30]))*100000,
+		time.UTC,
+	)
+
+	// apply any time correction which hasn't already been applied
+	if buf[36]&0x02 == 0 {
+		if c := int32(order.Uint32(buf[40:44])); c != 0 {
+			start = start.Add(time.Duration(c) * 100 * time.Microsecond)
+		}
+	}
+
+	factor, multiplier := float64(int16(order.Uint16(buf[32:34]))), float64(int16(order.Uint16(buf[34:36])))
+
+	var rate float64
+	switch {
+	case factor > 0 && multiplier > 0:
+		rate = factor * multiplier
+	case factor > 0 && multiplier < 0:
+		rate = -factor / multiplier
+	case factor < 0 && multiplier > 0:
+		rate = -multiplier / factor
+	case factor < 0 && multiplier < 0:
+		rate = 1.0 / (factor * multiplier)
+	}
+
+	return Header{
+		SequenceNumber: strings.TrimSpace(string(buf[0:6])),
+		Station:        strings.TrimSpace(string(buf[8:13])),
+		Location:       strings.TrimSpace(string(buf[13:15])),
+		Channel:        strings.TrimSpace(string(buf[15:18])),
+		Network:        strings.TrimSpace(string(buf[18:20])),
+		StartTime:      start,
+		Samples:        int(order.Uint16(buf[30:32])),
+		SampleRate:     rate,
+	}, nil
+}
+
+func (h Header) SrcName() string {
+	return strings.Join([]string{h.Network, h.Station, h.Location, h.Channel}, "_")
+}
+
+func (h Header) EndTime() time.Time {
+	if h.SampleRate <= 0.0 || h.Samples < 1 {
+		return h.StartTime
+	}
+	return h.StartTime.Add(time.Duration(float64(h.Samples-1) * float64(time.Second) / h.SampleRate))
+}
+
+// ReadRecords passes each fixed size miniseed record read to the given function, the record buffer is reused.
+func ReadRecords(rd io.Reader, fn func(Header, []byte) error) error {
+	buf := make([]byte, RecordSize)
+	for {
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		h, err := DecodeHeader(buf)
+		if err != nil {
+			return err
+		}
+		if err := fn(h, buf); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package seedlink
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRecord_DecodeHeader(t *testing.T) {
+
+	var tests = []struct {
+		f string
+		h Header
+	}{
+		{
+			"../testdata/NZ.APIM.50.LFZ.D.2016.215",
+			Header{
+				SequenceNumber: "001377",
+				Network:        "NZ",
+				Station:        "APIM",
+				Location:       "50",
+				Channel:        "LFZ",
+				StartTime:      time.Date(2016, 8, 2, 0, 6, 57, 69500000, time.UTC),
+				Samples:        422,
+				SampleRate:     1.0,
+			},
+		},
+	}
+
+	for _, x := range tests {
+		raw, err := ioutil.ReadFile(x.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h, err := DecodeHeader(raw[:RecordSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h != x.h {
+			t.Errorf("invalid header for %s, expected %v found %v", x.f, x.h, h)
+		}
+		if s := h.SrcName(); s != "NZ_APIM_50_LFZ" {
+			t.Errorf("invalid source name for %s: %s", x.f, s)
+		}
+	}
+}
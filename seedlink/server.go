@@ -0,0 +1,421 @@
+package seedlink
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serverVersion = "SeedLink v3.1 (raw replay) :: SLPROTO:3.1"
+
+// Server replays a fixed set of miniseed records to seedlink clients, it is intended for testing.
+type Server struct {
+	// replay speed relative to the record times, zero sends records as fast as possible
+	Pace float64
+
+	// close the n-th connection after sending the given number of packets
+	Disconnects []int
+
+	// optional logging of connection events
+	Logf func(string, ...interface{})
+
+	mu      sync.Mutex
+	packets []Packet
+	conns   int
+}
+
+func NewServer() *Server {
+	return &Server{}
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, v...)
+	}
+}
+
+// Add appends a miniseed record to the replay list with the next sequence number.
+func (s *Server) Add(record []byte) error {
+	if len(record) != RecordSize {
+		return fmt.Errorf("invalid record size: %d", len(record))
+	}
+	h, err := DecodeHeader(record)
+	if err != nil {
+		return err
+	}
+
+	s.add(h, record)
+
+	return nil
+}
+
+func (s *Server) add(h Header, record []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.packets = append(s.packets, Packet{
+		Sequence: len(s.packets) + 1,
+		Header:   h,
+		Record:   append([]byte{}, record...),
+	})
+}
+
+func (s *Server) AddStream(rd io.Reader) error {
+	return ReadRecords(rd, func(h Header, record []byte) error {
+		s.add(h, record)
+		return nil
+	})
+}
+
+func (s *Server) AddFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return s.AddStream(f)
+}
+
+func (s *Server) Packets() []Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Packet{}, s.packets...)
+}
+
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts client connections until the context is cancelled.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		limit := -1
+		if s.conns < len(s.Disconnects) {
+			limit = s.Disconnects[s.conns]
+		}
+		s.conns++
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, conn, limit)
+		}()
+	}
+}
+
+type selection struct {
+	network   string
+	station   string
+	selectors []string
+	sequence  int
+	begin     time.Time
+	end       time.Time
+	fetch     bool
+}
+
+func (s selection) match(p Packet) bool {
+	if ok, _ := path.Match(s.network, p.Header.Network); !ok {
+		return false
+	}
+	if ok, _ := path.Match(s.station, p.Header.Station); !ok {
+		return false
+	}
+	switch {
+	case s.sequence > 0 && p.Sequence < s.sequence:
+		return false
+	case s.sequence <= 0 && !s.begin.IsZero() && p.Header.EndTime().Before(s.begin):
+		return false
+	}
+	if !s.end.IsZero() && !p.Header.StartTime.Before(s.end) {
+		return false
+	}
+	return MatchSelectors(s.selectors, p.Header.Location, p.Header.Channel)
+}
+
+// MatchSelectors checks a location and channel against seedlink selectors in the form "[LL]CCC[.T]",
+// selectors starting with "!" exclude matching channels.
+func MatchSelectors(selectors []string, location, channel string) bool {
+	var include, exclude, positive bool
+	for _, sel := range selectors {
+		negate := strings.HasPrefix(sel, "!")
+		if negate {
+			sel = sel[1:]
+		} else {
+			positive = true
+		}
+		if !matchSelector(sel, location, channel) {
+			continue
+		}
+		switch {
+		case negate:
+			exclude = true
+		default:
+			include = true
+		}
+	}
+	return !exclude && (include || !positive)
+}
+
+func matchSelector(sel, location, channel string) bool {
+	if i := strings.Index(sel, "."); i >= 0 {
+		if t := sel[i+1:]; t != "D" && t != "?" {
+			return false
+		}
+		sel = sel[:i]
+	}
+
+	switch len(sel) {
+	case 3:
+		ok, _ := path.Match(sel, channel)
+		return ok
+	case 5:
+		loc := sel[:2]
+		if loc == "--" {
+			loc = ""
+		}
+		if ok, _ := path.Match(loc, location); !ok && !(loc == "??" && location == "") {
+			return false
+		}
+		ok, _ := path.Match(sel[2:], channel)
+		return ok
+	default:
+		return false
+	}
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	parts := strings.Split(s, ",")
+	for len(parts) < 6 {
+		parts = append(parts, "00")
+	}
+	return time.Parse(timestampFormat, strings.Join(parts[:6], ","))
+}
+
+type session struct {
+	sync.Mutex
+	conn net.Conn
+}
+
+func (s *session) write(b []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	_, err := s.conn.Write(b)
+	return err
+}
+
+func (s *session) reply(line string) error {
+	return s.write([]byte(line + "\r\n"))
+}
+
+func (s *session) info() error {
+	record := make([]byte, RecordSize)
+	copy(record, fmt.Sprintf("%-48s", "000000 INFO "))
+	copy(record[64:], fmt.Sprintf("<?xml version=\"1.0\"?><seedlink software=%q/>", serverVersion))
+	return s.write(append([]byte("SLINFO  "), record...))
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn, limit int) {
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	sess := &session{conn: conn}
+	rd := bufio.NewReader(conn)
+
+	var selections []selection
+	for {
+		line, err := response(rd)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var reply string
+		switch cmd := strings.ToUpper(fields[0]); cmd {
+		case "HELLO":
+			reply = serverVersion + "\r\nreplay"
+		case "STATION":
+			switch len(fields) {
+			case 3:
+				selections, reply = append(selections, selection{network: fields[2], station: fields[1]}), "OK"
+			default:
+				reply = "ERROR"
+			}
+		case "SELECT":
+			switch {
+			case len(selections) == 0, len(fields) != 2:
+				reply = "ERROR"
+			default:
+				sel := &selections[len(selections)-1]
+				sel.selectors, reply = append(sel.selectors, fields[1]), "OK"
+			}
+		case "DATA", "FETCH", "TIME":
+			if len(selections) == 0 {
+				reply = "ERROR"
+				break
+			}
+			sel := &selections[len(selections)-1]
+			sel.fetch, reply = cmd == "FETCH", "OK"
+			for i, f := range fields[1:] {
+				switch {
+				case cmd != "TIME" && i == 0:
+					seq, err := strconv.ParseInt(f, 16, 32)
+					if err != nil {
+						reply = "ERROR"
+					}
+					sel.sequence = int(seq)
+				case cmd == "TIME" && i == 1:
+					at, err := parseTimestamp(f)
+					if err != nil {
+						reply = "ERROR"
+					}
+					sel.end, sel.fetch = at, true
+				default:
+					at, err := parseTimestamp(f)
+					if err != nil {
+						reply = "ERROR"
+					}
+					sel.begin = at
+				}
+			}
+		case "INFO":
+			if err := sess.info(); err != nil {
+				return
+			}
+			continue
+		case "END":
+			s.stream(ctx, sess, rd, selections, limit)
+			return
+		case "BYE":
+			return
+		default:
+			reply = "ERROR"
+		}
+
+		if err := sess.reply(reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) stream(ctx context.Context, sess *session, rd *bufio.Reader, selections []selection, limit int) {
+
+	// handle keep-alive requests while streaming
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			line, err := response(rd)
+			if err != nil {
+				return
+			}
+			switch fields := strings.Fields(line); {
+			case len(fields) == 0:
+			case strings.ToUpper(fields[0]) == "INFO":
+				if err := sess.info(); err != nil {
+					return
+				}
+			case strings.ToUpper(fields[0]) == "BYE":
+				sess.conn.Close()
+				return
+			}
+		}
+	}()
+
+	var fetch bool
+	for _, sel := range selections {
+		fetch = fetch || sel.fetch
+	}
+
+	var sent int
+	var first time.Time
+	start := time.Now()
+
+	for _, p := range s.Packets() {
+		var ok bool
+		for _, sel := range selections {
+			ok = ok || sel.match(p)
+		}
+		if !ok {
+			continue
+		}
+
+		if s.Pace > 0 {
+			if first.IsZero() {
+				first = p.Header.StartTime
+			}
+			wait := time.Until(start.Add(time.Duration(float64(p.Header.StartTime.Sub(first)) / s.Pace)))
+			select {
+			case <-ctx.Done():
+				return
+			case <-closed:
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		if limit >= 0 && sent >= limit {
+			s.logf("seedlink replay: disconnecting %s after %d packets", sess.conn.RemoteAddr(), sent)
+			return
+		}
+
+		if err := sess.write(append([]byte(fmt.Sprintf("SL%06X", p.Sequence&0xffffff)), p.Record...)); err != nil {
+			return
+		}
+		sent++
+	}
+
+	if fetch {
+		sess.write([]byte("END"))
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-closed:
+	}
+}
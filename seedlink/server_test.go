@@ -0,0 +1,158 @@
+package seedlink
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testFile = "../testdata/NZ.APIM.50.LFZ.D.2016.215"
+
+func testServer(t *testing.T, disconnects ...int) (*Server, string) {
+	server := NewServer()
+	server.Disconnects = disconnects
+	if err := server.AddFile(testFile); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Serve(ctx, l)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return server, l.Addr().String()
+}
+
+func testClient(t *testing.T, addr, selectors string) *Client {
+	streams, err := ParseStreamList("NZ_APIM", selectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient([]string{addr}, streams)
+	client.NetTo, client.NetDly, client.Fetch = 5*time.Second, 10*time.Millisecond, true
+	return client
+}
+
+func collect(t *testing.T, client *Client, stop int) []Packet {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	errStop := errors.New("stop")
+
+	var packets []Packet
+	err := client.Collect(ctx, func(p Packet) error {
+		packets = append(packets, p)
+		if stop > 0 && len(packets) >= stop {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		t.Fatal(err)
+	}
+
+	return packets
+}
+
+func checkSequence(t *testing.T, packets []Packet, first, n int) {
+	if len(packets) != n {
+		t.Fatalf("invalid number of packets, expected %d found %d", n, len(packets))
+	}
+	for i, p := range packets {
+		if p.Sequence != first+i {
+			t.Fatalf("invalid packet sequence at %d, expected %d found %d", i, first+i, p.Sequence)
+		}
+	}
+}
+
+func TestServer_Fetch(t *testing.T) {
+	server, addr := testServer(t)
+
+	packets := collect(t, testClient(t, addr, "LFZ"), 0)
+	checkSequence(t, packets, 1, len(server.Packets()))
+
+	if s := packets[0].Header.SrcName(); s != "NZ_APIM_50_LFZ" {
+		t.Errorf("invalid packet source: %s", s)
+	}
+}
+
+func TestServer_Selectors(t *testing.T) {
+	_, addr := testServer(t)
+
+	if packets := collect(t, testClient(t, addr, "51LFZ"), 0); len(packets) != 0 {
+		t.Errorf("expected no packets with unmatched selector, found %d", len(packets))
+	}
+	if packets := collect(t, testClient(t, addr, "!LF?"), 0); len(packets) != 0 {
+		t.Errorf("expected no packets with negated selector, found %d", len(packets))
+	}
+}
+
+func TestServer_Reconnect(t *testing.T) {
+	server, addr := testServer(t, 50, 0, 75)
+
+	packets := collect(t, testClient(t, addr, "50LF?"), 0)
+	checkSequence(t, packets, 1, len(server.Packets()))
+}
+
+func TestServer_Resume(t *testing.T) {
+	server, addr := testServer(t)
+
+	state := filepath.Join(t.TempDir(), "state")
+
+	client := testClient(t, addr, "???")
+	first := collect(t, client, 100)
+	checkSequence(t, first, 1, 100)
+	if err := client.SaveState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	client = testClient(t, addr, "???")
+	if err := client.RecoverState(state); err != nil {
+		t.Fatal(err)
+	}
+	rest := collect(t, client, 0)
+	checkSequence(t, rest, 101, len(server.Packets())-100)
+}
+
+func TestServer_MatchSelectors(t *testing.T) {
+
+	var tests = []struct {
+		s []string
+		l string
+		c string
+		m bool
+	}{
+		{nil, "50", "LFZ", true},
+		{[]string{"???"}, "50", "LFZ", true},
+		{[]string{"LF?.D"}, "50", "LFZ", true},
+		{[]string{"LF?.L"}, "50", "LFZ", false},
+		{[]string{"50LF?"}, "50", "LFZ", true},
+		{[]string{"51LF?"}, "50", "LFZ", false},
+		{[]string{"--LFZ"}, "", "LFZ", true},
+		{[]string{"??LFZ"}, "", "LFZ", true},
+		{[]string{"!LFZ"}, "50", "LFZ", false},
+		{[]string{"!LFZ"}, "50", "LFN", true},
+		{[]string{"LF?", "!LFZ"}, "50", "LFZ", false},
+		{[]string{"LF?", "!LFZ"}, "50", "LFE", true},
+	}
+
+	for _, x := range tests {
+		if m := MatchSelectors(x.s, x.l, x.c); m != x.m {
+			t.Errorf("invalid selector match for %v %s %s, expected %v", x.s, x.l, x.c, x.m)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package seedlink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timestampFormat = "2006,01,02,15,04,05"
+
+// The state file is a JSON document holding the resume information for each network and station,
+// entries without a sequence number are not stored.
+//
+//	{
+//	  "streams": [
+//	    {
+//	      "network": "NZ",
+//	      "station": "APIM",
+//	      "server": "link.geonet.org.nz:18000",
+//	      "sequence": 1377,
+//	      "time": "2016-08-02T00:13:58.0695Z"
+//	    }
+//	  ]
+//	}
+//
+// The sequence number is only used when resuming from the server given, otherwise collection
+// restarts from the time of the last sample received.
+type State struct {
+	Streams []StreamState `json:"streams"`
+}
+
+type StreamState struct {
+	Network  string     `json:"network"`
+	Station  string     `json:"station"`
+	Server   string     `json:"server,omitempty"`
+	Sequence int        `json:"sequence"`
+	Time     *time.Time `json:"time,omitempty"`
+}
+
+func NewState(streams []Stream) State {
+	var state State
+	for _, s := range streams {
+		if s.Sequence < 0 {
+			continue
+		}
+		ss := StreamState{
+			Network:  s.Network,
+			Station:  s.Station,
+			Server:   s.Server,
+			Sequence: s.Sequence,
+		}
+		if !s.Timestamp.IsZero() {
+			at := s.Timestamp.UTC()
+			ss.Time = &at
+		}
+		state.Streams = append(state.Streams, ss)
+	}
+
+	sort.Slice(state.Streams, func(i, j int) bool {
+		return state.Streams[i].Key() < state.Streams[j].Key()
+	})
+
+	return state
+}
+
+func (s StreamState) Key() string {
+	return strings.Join([]string{s.Network, s.Station}, "_")
+}
+
+func (s State) Stream(network, station string) (StreamState, bool) {
+	for _, ss := range s.Streams {
+		if ss.Network == network && ss.Station == station {
+			return ss, true
+		}
+	}
+	return StreamState{}, false
+}
+
+// Set adds or replaces the state for a network and station.
+func (s *State) Set(ss StreamState) {
+	for i := range s.Streams {
+		if s.Streams[i].Key() == ss.Key() {
+			s.Streams[i] = ss
+			return
+		}
+	}
+	s.Streams = append(s.Streams, ss)
+	sort.Slice(s.Streams, func(i, j int) bool {
+		return s.Streams[i].Key() < s.Streams[j].Key()
+	})
+}
+
+// Delete removes the state for a network and station, it reports whether an entry was found.
+func (s *State) Delete(network, station string) bool {
+	for i := range s.Streams {
+		if s.Streams[i].Network == network && s.Streams[i].Station == station {
+			s.Streams = append(s.Streams[:i], s.Streams[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Apply updates the resume information of any streams with a matching state entry.
+func (s State) Apply(streams []Stream) {
+	for i := range streams {
+		ss, ok := s.Stream(streams[i].Network, streams[i].Station)
+		if !ok {
+			continue
+		}
+		streams[i].Server, streams[i].Sequence, streams[i].Timestamp = ss.Server, ss.Sequence, time.Time{}
+		if ss.Time != nil {
+			streams[i].Timestamp = *ss.Time
+		}
+	}
+}
+
+func (s State) Encode(wr io.Writer) error {
+	enc := json.NewEncoder(wr)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// DecodeState reads either a JSON state file or a legacy libslink state file.
+func DecodeState(rd io.Reader) (State, error) {
+	raw, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return State{}, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		return DecodeLegacyState(bytes.NewReader(raw))
+	}
+
+	var state State
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return State{}, err
+	}
+	for n, ss := range state.Streams {
+		if ss.Network == "" || ss.Station == "" {
+			return State{}, fmt.Errorf("entry %d: missing network or station", n+1)
+		}
+	}
+
+	return state, nil
+}
+
+// DecodeLegacyState reads the libslink state file format of "NET STA SEQ [YYYY,MM,DD,hh,mm,ss]" lines.
+func DecodeLegacyState(rd io.Reader) (State, error) {
+	var state State
+
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return State{}, fmt.Errorf("line %d: invalid state entry", n)
+		}
+		seq, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return State{}, fmt.Errorf("line %d: invalid sequence number: %v", n, err)
+		}
+		ss := StreamState{
+			Network:  fields[0],
+			Station:  fields[1],
+			Sequence: seq,
+		}
+		if len(fields) > 3 {
+			at, err := time.Parse(timestampFormat, fields[3])
+			if err != nil {
+				return State{}, fmt.Errorf("line %d: invalid timestamp: %v", n, err)
+			}
+			ss.Time = &at
+		}
+		state.Set(ss)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return State{}, err
+	}
+
+	return state, nil
+}
+
+func ReadStateFile(path string) (State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return State{}, err
+	}
+	defer f.Close()
+
+	return DecodeState(f)
+}
+
+// WriteStateFile atomically replaces the state file.
+func WriteStateFile(path string, state State) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	defer os.Chmod(path, 0644)
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".xxxx")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := state.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	return nil
+}
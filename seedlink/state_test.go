@@ -0,0 +1,120 @@
+package seedlink
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestState_File(t *testing.T) {
+	at := time.Date(2016, 8, 2, 0, 13, 58, 69500000, time.UTC)
+
+	streams := []Stream{
+		{Network: "NZ", Station: "EYWM", Sequence: 12},
+		{Network: "NZ", Station: "APIM", Server: "localhost:18000", Sequence: 1377, Timestamp: at},
+		{Network: "NZ", Station: "SMHS", Sequence: -1},
+	}
+
+	path := filepath.Join(t.TempDir(), "state", "slraw.json")
+	if err := WriteStateFile(path, NewState(streams)); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{
+  "streams": [
+    {
+      "network": "NZ",
+      "station": "APIM",
+      "server": "localhost:18000",
+      "sequence": 1377,
+      "time": "2016-08-02T00:13:58.0695Z"
+    },
+    {
+      "network": "NZ",
+      "station": "EYWM",
+      "sequence": 12
+    }
+  ]
+}
+`
+	if string(raw) != expected {
+		t.Errorf("invalid state file, expected:\n%s\nfound:\n%s", expected, string(raw))
+	}
+
+	state, err := ReadStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := []Stream{
+		{Network: "NZ", Station: "EYWM", Sequence: -1},
+		{Network: "NZ", Station: "APIM", Sequence: -1},
+		{Network: "NZ", Station: "SMHS", Sequence: -1},
+	}
+	state.Apply(check)
+
+	if !reflect.DeepEqual(check, streams) {
+		t.Errorf("invalid recovered state, expected %v found %v", streams, check)
+	}
+}
+
+func TestState_Legacy(t *testing.T) {
+	at := time.Date(2016, 8, 2, 4, 0, 0, 0, time.UTC)
+
+	state, err := DecodeState(strings.NewReader("NZ EYWM 12\nNZ APIM 1377 2016,08,02,04,00,00\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := State{
+		Streams: []StreamState{
+			{Network: "NZ", Station: "APIM", Sequence: 1377, Time: &at},
+			{Network: "NZ", Station: "EYWM", Sequence: 12},
+		},
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("invalid legacy state, expected %v found %v", expected, state)
+	}
+
+	for _, s := range []string{"NZ APIM\n", "NZ APIM x\n", "NZ APIM 12 2016-08-02\n"} {
+		if _, err := DecodeState(strings.NewReader(s)); err == nil {
+			t.Errorf("expected an error decoding legacy state %q", s)
+		}
+	}
+}
+
+func TestState_Edit(t *testing.T) {
+	var state State
+
+	state.Set(StreamState{Network: "NZ", Station: "SMHS", Sequence: 1})
+	state.Set(StreamState{Network: "NZ", Station: "APIM", Sequence: 2})
+	state.Set(StreamState{Network: "NZ", Station: "SMHS", Sequence: 3})
+
+	if !state.Delete("NZ", "APIM") {
+		t.Error("unable to delete state entry")
+	}
+	if state.Delete("NZ", "APIM") {
+		t.Error("unexpected deletion of a missing state entry")
+	}
+
+	var buf bytes.Buffer
+	if err := state.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	check, err := DecodeState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss, ok := check.Stream("NZ", "SMHS"); !ok || ss.Sequence != 3 || len(check.Streams) != 1 {
+		t.Errorf("invalid edited state: %v", check)
+	}
+}
@@ -0,0 +1,68 @@
+package seedlink
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+type Stream struct {
+	Network   string
+	Station   string
+	Selectors []string
+
+	// resume information, the server which issued the last sequence number, or a negative
+	// value if unset, and the time of the last sample received
+	Server    string
+	Sequence  int
+	Timestamp time.Time
+}
+
+func (s Stream) Key() string {
+	return strings.Join([]string{s.Network, s.Station}, "_")
+}
+
+func (s Stream) Match(network, station string) bool {
+	if ok, err := path.Match(s.Network, network); err != nil || !ok {
+		return false
+	}
+	if ok, err := path.Match(s.Station, station); err != nil || !ok {
+		return false
+	}
+	return true
+}
+
+// ParseStreamList decodes a list of streams in the form "NET_STA[:SEL SEL],NET_STA",
+// streams without explicit selectors are given the default selectors.
+func ParseStreamList(streams, selectors string) ([]Stream, error) {
+	var list []Stream
+	for _, s := range strings.Split(streams, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		sels := strings.Fields(selectors)
+		if i := strings.Index(s, ":"); i >= 0 {
+			s, sels = s[:i], strings.Fields(s[i+1:])
+		}
+
+		parts := strings.Split(s, "_")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid stream: %s", s)
+		}
+
+		list = append(list, Stream{
+			Network:   parts[0],
+			Station:   parts[1],
+			Selectors: sels,
+			Sequence:  -1,
+		})
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no streams given")
+	}
+
+	return list, nil
+}
@@ -0,0 +1,46 @@
+package seedlink
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStream_ParseStreamList(t *testing.T) {
+
+	var tests = []struct {
+		streams, selectors string
+		list               []Stream
+	}{
+		{
+			"*_*",
+			"???",
+			[]Stream{
+				{Network: "*", Station: "*", Selectors: []string{"???"}, Sequence: -1},
+			},
+		},
+		{
+			"NZ_APIM:50L?? 51L??, NZ_EYWM",
+			"LF?",
+			[]Stream{
+				{Network: "NZ", Station: "APIM", Selectors: []string{"50L??", "51L??"}, Sequence: -1},
+				{Network: "NZ", Station: "EYWM", Selectors: []string{"LF?"}, Sequence: -1},
+			},
+		},
+	}
+
+	for _, x := range tests {
+		list, err := ParseStreamList(x.streams, x.selectors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(list, x.list) {
+			t.Errorf("invalid stream list for %q, expected %v found %v", x.streams, x.list, list)
+		}
+	}
+
+	for _, s := range []string{"", "NZ", "NZ_", "NZ_APIM_50"} {
+		if _, err := ParseStreamList(s, "???"); err == nil {
+			t.Errorf("expected an error parsing stream list %q", s)
+		}
+	}
+}
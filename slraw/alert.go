@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+// how long an alert hook or webhook may take
+const alertTimeout = 30 * time.Second
+
+// how many alerts may wait for earlier ones to be delivered before more are dropped
+const alertQueue = 1024
+
+type streamStatus struct {
+	lastSample  time.Time
+	lastArrival time.Time
+	stale       bool
+}
+
+// alert describes a change in a stream's state, it is passed to any exec hook as environment
+// variables and posted as json to any webhook.
+type alert struct {
+	Stream      string    `json:"stream"`
+	State       string    `json:"state"`
+	LastSample  time.Time `json:"last_sample"`
+	LastArrival time.Time `json:"last_arrival"`
+	DataLatency float64   `json:"data_latency"`
+	FeedLatency float64   `json:"feed_latency"`
+}
+
+func (a alert) env() []string {
+	return []string{
+		"SLRAW_STREAM=" + a.Stream,
+		"SLRAW_STATE=" + a.State,
+		"SLRAW_LAST_SAMPLE=" + a.LastSample.Format(time.RFC3339Nano),
+		"SLRAW_LAST_ARRIVAL=" + a.LastArrival.Format(time.RFC3339Nano),
+		fmt.Sprintf("SLRAW_DATA_LATENCY=%.3f", a.DataLatency),
+		fmt.Sprintf("SLRAW_FEED_LATENCY=%.3f", a.FeedLatency),
+	}
+}
+
+// monitor tracks the most recent sample and arrival time of each stream and raises alerts when a
+// stream has not been heard from within the stale threshold, and again when it recovers.
+type monitor struct {
+	sync.Mutex
+
+	threshold time.Duration
+	hook      string
+	webhook   string
+	stats     *metrics
+
+	streams map[string]*streamStatus
+	alerts  chan alert
+}
+
+func newMonitor(threshold time.Duration, hook, webhook string, stats *metrics) *monitor {
+	return &monitor{
+		threshold: threshold,
+		hook:      hook,
+		webhook:   webhook,
+		stats:     stats,
+		streams:   make(map[string]*streamStatus),
+		alerts:    make(chan alert, alertQueue),
+	}
+}
+
+func (m *monitor) status(stream string, s *streamStatus, state string, now time.Time) alert {
+	return alert{
+		Stream:      stream,
+		State:       state,
+		LastSample:  s.lastSample.UTC(),
+		LastArrival: s.lastArrival.UTC(),
+		DataLatency: s.lastArrival.Sub(s.lastSample).Seconds(),
+		FeedLatency: now.Sub(s.lastArrival).Seconds(),
+	}
+}
+
+// observe records the arrival of decoded readings.
+func (m *monitor) observe(readings []raw.Reading) {
+	if m == nil || len(readings) == 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	for _, r := range readings {
+		s, ok := m.streams[r.Source]
+		if !ok {
+			s = &streamStatus{}
+			m.streams[r.Source] = s
+		}
+		if r.Epoch.After(s.lastSample) {
+			s.lastSample = r.Epoch
+		}
+		s.lastArrival = now
+	}
+
+	for _, r := range readings {
+		s := m.streams[r.Source]
+		m.stats.sample(r.Source, s.lastSample, false)
+		if s.stale {
+			s.stale = false
+			m.queue(m.status(r.Source, s, "recovered", now))
+		}
+	}
+}
+
+// check raises alerts for any streams which have just become stale.
+func (m *monitor) check() {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	for k, s := range m.streams {
+		if s.stale || now.Sub(s.lastArrival) <= m.threshold {
+			continue
+		}
+		s.stale = true
+		m.stats.sample(k, s.lastSample, true)
+		m.queue(m.status(k, s, "stale", now))
+	}
+}
+
+// queue hands an alert to the worker without blocking, dropping it if the worker has fallen too far behind.
+func (m *monitor) queue(a alert) {
+	select {
+	case m.alerts <- a:
+	default:
+		log.Printf("alert: too many pending alerts, dropping: %s %s", a.Stream, a.State)
+	}
+}
+
+// deliver raises the queued alerts one at a time, so hooks and webhooks see the transitions in order.
+func (m *monitor) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case a := <-m.alerts:
+			m.raise(a)
+		}
+	}
+}
+
+func (m *monitor) run(ctx context.Context) {
+	go m.deliver(ctx)
+
+	interval := m.threshold / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			m.check()
+		}
+	}
+}
+
+func (m *monitor) raise(a alert) {
+	log.Printf("alert: %s %s, last sample %s, data latency %.1fs, feed latency %.1fs",
+		a.Stream, a.State, a.LastSample.Format(time.RFC3339), a.DataLatency, a.FeedLatency)
+
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+
+	if m.hook != "" {
+		cmd := exec.CommandContext(ctx, m.hook)
+		cmd.Env = append(os.Environ(), a.env()...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("alert: unable to run hook %s: %v: %s", m.hook, err, bytes.TrimSpace(out))
+		}
+	}
+
+	if m.webhook != "" {
+		body, err := json.Marshal(a)
+		if err != nil {
+			log.Printf("alert: unable to encode webhook: %v", err)
+			return
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.webhook, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("alert: invalid webhook: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Printf("alert: unable to post webhook: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			log.Printf("alert: webhook returned %s", resp.Status)
+		}
+	}
+}
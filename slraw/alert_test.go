@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+// testAlert returns the next queued alert.
+func testAlert(t *testing.T, m *monitor) alert {
+	select {
+	case a := <-m.alerts:
+		return a
+	default:
+		t.Fatal("expected a queued alert")
+	}
+	return alert{}
+}
+
+func TestMonitor_Transitions(t *testing.T) {
+
+	stats := newMetrics()
+	m := newMonitor(20*time.Millisecond, "", "", stats)
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	m.observe([]raw.Reading{
+		{Source: "NZ_APIM_50_LFZ", Epoch: at, Value: 1},
+		{Source: "NZ_APIM_50_LFZ", Epoch: at.Add(time.Second), Value: 2},
+	})
+
+	// nothing is raised for a stream which is up to date
+	m.check()
+	if len(m.alerts) != 0 {
+		t.Fatalf("unexpected alerts for a current stream: %d", len(m.alerts))
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	m.check()
+	a := testAlert(t, m)
+	if a.Stream != "NZ_APIM_50_LFZ" || a.State != "stale" {
+		t.Errorf("invalid alert, expected NZ_APIM_50_LFZ stale found %s %s", a.Stream, a.State)
+	}
+	if !a.LastSample.Equal(at.Add(time.Second)) {
+		t.Errorf("invalid last sample, expected %s found %s", at.Add(time.Second), a.LastSample)
+	}
+	if a.FeedLatency < 0.02 {
+		t.Errorf("invalid feed latency: %g", a.FeedLatency)
+	}
+	if !stats.streams["NZ_APIM_50_LFZ"].stale {
+		t.Error("expected the stream to be reported as stale")
+	}
+
+	// a stale stream is only raised once
+	m.check()
+	if len(m.alerts) != 0 {
+		t.Fatalf("unexpected repeated alerts: %d", len(m.alerts))
+	}
+
+	m.observe([]raw.Reading{
+		{Source: "NZ_APIM_50_LFZ", Epoch: at.Add(2 * time.Second), Value: 3},
+	})
+	if a := testAlert(t, m); a.State != "recovered" || !a.LastSample.Equal(at.Add(2*time.Second)) {
+		t.Errorf("invalid alert, expected recovered at %s found %s at %s", at.Add(2*time.Second), a.State, a.LastSample)
+	}
+	if stats.streams["NZ_APIM_50_LFZ"].stale {
+		t.Error("expected the stream to be reported as recovered")
+	}
+}
+
+func TestMonitor_Hook(t *testing.T) {
+
+	dir := t.TempDir()
+	hook, out := filepath.Join(dir, "hook.sh"), filepath.Join(dir, "env.txt")
+
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nenv | grep '^SLRAW_' > \""+out+"\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	newMonitor(time.Minute, hook, "", newMetrics()).raise(alert{
+		Stream:      "NZ_APIM_50_LFZ",
+		State:       "stale",
+		LastSample:  at,
+		LastArrival: at.Add(1500 * time.Millisecond),
+		DataLatency: 1.5,
+		FeedLatency: 600,
+	})
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if k, v, ok := strings.Cut(l, "="); ok {
+			env[k] = v
+		}
+	}
+
+	for k, v := range map[string]string{
+		"SLRAW_STREAM":       "NZ_APIM_50_LFZ",
+		"SLRAW_STATE":        "stale",
+		"SLRAW_LAST_SAMPLE":  "2016-08-02T04:00:00Z",
+		"SLRAW_LAST_ARRIVAL": "2016-08-02T04:00:01.5Z",
+		"SLRAW_DATA_LATENCY": "1.500",
+		"SLRAW_FEED_LATENCY": "600.000",
+	} {
+		if env[k] != v {
+			t.Errorf("invalid hook environment %s, expected %q found %q", k, v, env[k])
+		}
+	}
+}
+
+func TestMonitor_Webhook(t *testing.T) {
+
+	var mu sync.Mutex
+	var posted []alert
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("invalid webhook request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		var a alert
+		if err := json.Unmarshal(b, &a); err != nil {
+			t.Errorf("invalid webhook body %q: %v", b, err)
+		}
+		// slow deliveries must not let later alerts overtake earlier ones
+		if a.State == "stale" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		mu.Lock()
+		posted = append(posted, a)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	m := newMonitor(time.Minute, "", server.URL, newMetrics())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.run(ctx)
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	states := []string{"stale", "recovered", "stale", "recovered"}
+	for i, s := range states {
+		m.queue(alert{Stream: "NZ_APIM_50_LFZ", State: s, LastSample: at.Add(time.Duration(i) * time.Second), DataLatency: 1.5})
+	}
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		n := len(posted)
+		mu.Unlock()
+		if n == len(states) {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(posted) != len(states) {
+		t.Fatalf("invalid number of webhooks, expected %d found %d", len(states), len(posted))
+	}
+	for i, a := range posted {
+		if a.Stream != "NZ_APIM_50_LFZ" || a.State != states[i] || !a.LastSample.Equal(at.Add(time.Duration(i)*time.Second)) || a.DataLatency != 1.5 {
+			t.Errorf("invalid webhook %d: %+v", i, a)
+		}
+	}
+}
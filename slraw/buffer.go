@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+
+	"github.com/ozym/raw"
+)
+
+type streamBuffer struct {
+	file     string
+	readings []raw.Reading
+}
+
+// buffer holds readings per stream until they are due to be stored, readings are released
+// early once the file they belong to is complete or when the buffer limits are reached.
+type buffer struct {
+	filename func(raw.Reading) (string, error)
+
+	// overall and per stream limits on the number of buffered readings, zero for no limit
+	limit       int
+	streamLimit int
+
+	streams map[string]*streamBuffer
+	total   int
+
+	// streams whose readings can't be named, these are only logged once
+	unnamed map[string]bool
+}
+
+func newBuffer(filename func(raw.Reading) (string, error), limit, streamLimit int) *buffer {
+	return &buffer{
+		filename:    filename,
+		limit:       limit,
+		streamLimit: streamLimit,
+		streams:     make(map[string]*streamBuffer),
+		unnamed:     make(map[string]bool),
+	}
+}
+
+func (b *buffer) Len() int {
+	return b.total
+}
+
+func (b *buffer) release(s *streamBuffer) []raw.Reading {
+	r := s.readings
+	b.total -= len(r)
+	s.readings = nil
+	return r
+}
+
+// Add buffers the given readings and returns any which are now ready to be stored. Readings which
+// can't be given a file name, e.g. from stations missing from the inventory, are dropped as they
+// would otherwise fail every batch they were stored with.
+func (b *buffer) Add(readings []raw.Reading) []raw.Reading {
+	var ready []raw.Reading
+
+	for _, r := range readings {
+		file, err := b.filename(r)
+		if err != nil {
+			if !b.unnamed[r.Source] {
+				log.Printf("dropping readings from %s: %v", r.Source, err)
+				b.unnamed[r.Source] = true
+			}
+			continue
+		}
+
+		s, ok := b.streams[r.Source]
+		if !ok {
+			s = &streamBuffer{}
+			b.streams[r.Source] = s
+		}
+
+		// a change of file implies the previous one is complete
+		if len(s.readings) > 0 && file != s.file {
+			ready = append(ready, b.release(s)...)
+		}
+
+		s.file, s.readings = file, append(s.readings, r)
+		b.total++
+
+		if b.streamLimit > 0 && len(s.readings) >= b.streamLimit {
+			ready = append(ready, b.release(s)...)
+		}
+	}
+
+	if b.limit > 0 && b.total >= b.limit {
+		ready = append(ready, b.Flush()...)
+	}
+
+	return ready
+}
+
+// Flush returns all buffered readings.
+func (b *buffer) Flush() []raw.Reading {
+	var ready []raw.Reading
+	for k, s := range b.streams {
+		ready = append(ready, b.release(s)...)
+		delete(b.streams, k)
+	}
+	return ready
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+func TestBuffer_Unnamed(t *testing.T) {
+
+	inv := &raw.Inventory{
+		Stations: []raw.StationInfo{{Network: "NZ", Station: "APIM", IAGA: "API"}},
+	}
+	tmpl, err := raw.NewTemplateWith("{{IAGA .}}/{{Year .Epoch}}.{{Doy .Epoch}}.csv", nil, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := newBuffer(tmpl.Execute, 0, 0)
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	if ready := b.Add([]raw.Reading{
+		{Source: "NZ_APIM_50_LFZ", Epoch: at, Value: 1},
+		{Source: "NZ_SBAM_50_LFZ", Epoch: at, Value: 2},
+		{Source: "NZ_APIM_50_LFZ", Epoch: at.Add(time.Second), Value: 3},
+	}); len(ready) != 0 {
+		t.Errorf("unexpected ready readings: %d", len(ready))
+	}
+	if b.Len() != 2 {
+		t.Errorf("invalid number of buffered readings, expected %d found %d", 2, b.Len())
+	}
+
+	dir, err := ioutil.TempDir("", "slraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the remaining readings can all be stored
+	ready := b.Flush()
+	if _, err := raw.Store(dir, raw.Csv{}, tmpl.Execute, ready); err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 2 {
+		t.Errorf("invalid number of flushed readings, expected %d found %d", 2, len(ready))
+	}
+}
+
+func TestBuffer_FileBoundary(t *testing.T) {
+
+	storage, err := raw.NewTemplate(testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := newBuffer(storage.Execute, 0, 0)
+
+	at := time.Date(2016, time.August, 2, 4, 59, 58, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if ready := b.Add([]raw.Reading{
+			{Source: "NZ_APIM_50_LFZ", Epoch: at.Add(time.Duration(i) * time.Second), Value: float64(i)},
+			{Source: "NZ_APIM_50_LFX", Epoch: at.Add(time.Duration(i) * time.Second), Value: float64(i)},
+		}); len(ready) != 0 {
+			t.Fatalf("unexpected early release of %d readings", len(ready))
+		}
+	}
+
+	// the next hour completes the previous file for that stream only
+	ready := b.Add([]raw.Reading{{Source: "NZ_APIM_50_LFZ", Epoch: at.Add(2 * time.Second), Value: 2}})
+	if len(ready) != 2 {
+		t.Fatalf("invalid number of released readings, expected %d found %d", 2, len(ready))
+	}
+	for _, r := range ready {
+		if r.Source != "NZ_APIM_50_LFZ" || r.Epoch.Hour() != 4 {
+			t.Errorf("unexpected released reading: %s %s", r.Source, r.Epoch)
+		}
+	}
+	if b.Len() != 3 {
+		t.Errorf("invalid number of buffered readings, expected %d found %d", 3, b.Len())
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ozym/raw/seedlink"
+)
+
+// connection describes a single seedlink collection, unset values are taken from the command line.
+type connection struct {
+	Name      string   `json:"name"`
+	Servers   []string `json:"servers"`
+	Streams   string   `json:"streams"`
+	Selectors string   `json:"selectors"`
+	StateFile string   `json:"statefile"`
+
+	Offset *float64 `json:"offset"`
+	Scale  *float64 `json:"scale"`
+
+	NetTo     *int   `json:"netto"`
+	NetDly    *int   `json:"netdly"`
+	MaxDly    *int   `json:"maxdly"`
+	KeepAlive *int   `json:"keepalive"`
+	Recheck   string `json:"recheck"`
+
+	client *seedlink.Client
+}
+
+// config is the optional json file describing several connections which share the storage pipeline.
+type config struct {
+	Connections []*connection `json:"connections"`
+}
+
+func readConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	var c config
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if len(c.Connections) == 0 {
+		return nil, fmt.Errorf("no connections given")
+	}
+
+	// each connection saves its own state
+	states := make(map[string]bool)
+	for _, conn := range c.Connections {
+		if conn.StateFile == "" {
+			continue
+		}
+		path := filepath.Clean(conn.StateFile)
+		if states[path] {
+			return nil, fmt.Errorf("state file used by more than one connection: %s", conn.StateFile)
+		}
+		states[path] = true
+	}
+
+	return &c, nil
+}
+
+// defaults fills any unset connection values, state files are never shared so are not inherited.
+func (c *connection) defaults(d connection) {
+	if c.Name == "" {
+		c.Name = d.Name
+	}
+	if len(c.Servers) == 0 {
+		c.Servers = d.Servers
+	}
+	if c.Streams == "" {
+		c.Streams = d.Streams
+	}
+	if c.Selectors == "" {
+		c.Selectors = d.Selectors
+	}
+	if c.Offset == nil {
+		c.Offset = d.Offset
+	}
+	if c.Scale == nil {
+		c.Scale = d.Scale
+	}
+	if c.NetTo == nil {
+		c.NetTo = d.NetTo
+	}
+	if c.NetDly == nil {
+		c.NetDly = d.NetDly
+	}
+	if c.MaxDly == nil {
+		c.MaxDly = d.MaxDly
+	}
+	if c.KeepAlive == nil {
+		c.KeepAlive = d.KeepAlive
+	}
+	if c.Recheck == "" {
+		c.Recheck = d.Recheck
+	}
+}
+
+// open prepares the seedlink client and recovers any running state.
+func (c *connection) open(stats *metrics) error {
+	list, err := seedlink.ParseStreamList(c.Streams, c.Selectors)
+	if err != nil {
+		return fmt.Errorf("unable to parse streams: %v", err)
+	}
+
+	client := seedlink.NewClient(c.Servers, list)
+	client.Logf = func(format string, v ...interface{}) {
+		log.Printf("["+c.Name+"] "+format, v...)
+	}
+
+	if *c.NetDly > 0 {
+		client.NetDly = time.Duration(*c.NetDly) * time.Second
+	}
+	if *c.NetTo > 0 {
+		client.NetTo = time.Duration(*c.NetTo) * time.Second
+	}
+	client.MaxDly = time.Duration(*c.MaxDly) * time.Second
+	client.KeepAlive = time.Duration(*c.KeepAlive) * time.Second
+	if client.Recheck, err = time.ParseDuration(c.Recheck); err != nil {
+		return fmt.Errorf("invalid recheck interval: %v", err)
+	}
+
+	client.OnError = func(string, error) {
+		stats.connectionError()
+	}
+
+	if c.StateFile != "" {
+		if _, err := os.Stat(c.StateFile); err == nil {
+			log.Printf("[%s] read initial state: %s", c.Name, c.StateFile)
+			if err := client.RecoverState(c.StateFile); err != nil {
+				log.Printf("[%s] unable to read state: %s: %v", c.Name, c.StateFile, err)
+			}
+		}
+	}
+
+	c.client = client
+
+	return nil
+}
+
+func (c *connection) saveState() error {
+	if c.StateFile == "" || c.client == nil {
+		return nil
+	}
+	return c.client.SaveState(c.StateFile)
+}
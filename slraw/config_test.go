@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig_StateFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "slraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, x := range []struct {
+		config string
+		ok     bool
+	}{
+		{`{"connections": [{"statefile": "a.json"}, {"statefile": "b.json"}, {}, {}]}`, true},
+		{`{"connections": [{"statefile": "a.json"}, {"statefile": "./a.json"}]}`, false},
+		{`{"connections": []}`, false},
+	} {
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(x.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := readConfig(path)
+		switch {
+		case x.ok && err != nil:
+			t.Errorf("unexpected error for %s: %v", x.config, err)
+		case !x.ok && err == nil:
+			t.Errorf("expected an error for %s", x.config)
+		}
+	}
+
+	// the command line state file is not shared
+	conn := connection{}
+	conn.defaults(connection{StateFile: "slraw.json"})
+	if conn.StateFile != "" {
+		t.Errorf("unexpected inherited state file: %s", conn.StateFile)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+// sse comment interval to keep idle connections open
+const keepAlive = 15 * time.Second
+
+// how long a write to a live client may block before it is disconnected
+const writeTimeout = 10 * time.Second
+
+type liveReading struct {
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	Value  float64   `json:"value"`
+}
+
+type subscriber struct {
+	streams []string
+	queue   chan []byte
+	done    chan struct{}
+	once    sync.Once
+	dropped int
+}
+
+func (s *subscriber) match(source string) bool {
+	if len(s.streams) == 0 {
+		return true
+	}
+	for _, p := range s.streams {
+		if ok, _ := path.Match(p, source); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// fanout passes decoded readings to live subscribers, a subscriber that can't keep up has
+// messages dropped and is disconnected once its queue has been full for a whole queue's
+// worth of messages, publishing never blocks.
+type fanout struct {
+	sync.Mutex
+
+	size        int
+	timeout     time.Duration
+	subscribers map[*subscriber]struct{}
+}
+
+func newFanout(size int) *fanout {
+	return &fanout{
+		size:        size,
+		timeout:     writeTimeout,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+func (f *fanout) subscribe(streams []string) *subscriber {
+	f.Lock()
+	defer f.Unlock()
+
+	s := &subscriber{
+		streams: streams,
+		queue:   make(chan []byte, f.size),
+		done:    make(chan struct{}),
+	}
+	f.subscribers[s] = struct{}{}
+
+	return s
+}
+
+func (f *fanout) unsubscribe(s *subscriber) {
+	f.Lock()
+	defer f.Unlock()
+
+	delete(f.subscribers, s)
+	s.close()
+}
+
+func (f *fanout) publish(readings []raw.Reading) {
+	if f == nil {
+		return
+	}
+
+	f.Lock()
+	n := len(f.subscribers)
+	f.Unlock()
+	if n == 0 {
+		return
+	}
+
+	// each message is shared by all the subscribers and encoded outside the lock
+	msgs := make([][]byte, len(readings))
+	for i, r := range readings {
+		msg, err := json.Marshal(liveReading{Source: r.Source, Time: r.Epoch, Value: r.Value})
+		if err != nil {
+			continue
+		}
+		msgs[i] = msg
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	for s := range f.subscribers {
+		for i, r := range readings {
+			if msgs[i] == nil || !s.match(r.Source) {
+				continue
+			}
+			select {
+			case s.queue <- msgs[i]:
+				s.dropped = 0
+			default:
+				if s.dropped++; s.dropped >= f.size {
+					delete(f.subscribers, s)
+					s.close()
+				}
+			}
+		}
+	}
+}
+
+func (f *fanout) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// a client which stops reading blocks writes, the deadline lets the handler notice it has been dropped
+	rc := http.NewResponseController(w)
+
+	s := f.subscribe(r.URL.Query()["stream"])
+	defer f.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	tick := time.NewTicker(keepAlive)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			log.Printf("live: dropping slow client %s", r.RemoteAddr)
+			return
+		case <-tick.C:
+			rc.SetWriteDeadline(time.Now().Add(f.timeout))
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case msg := <-s.queue:
+			rc.SetWriteDeadline(time.Now().Add(f.timeout))
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", msg); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fanout) websocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebsocket(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer ws.conn.Close()
+
+	// a client which stops reading blocks writes, the deadline lets the handler notice it has been dropped
+	ws.timeout = f.timeout
+
+	s := f.subscribe(r.URL.Query()["stream"])
+	defer f.unsubscribe(s)
+
+	// control frames are handled by the writer to avoid concurrent writes
+	control, closed := make(chan []byte, 1), make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			op, payload, err := ws.readFrame()
+			if err != nil {
+				return
+			}
+			switch op {
+			case opClose:
+				return
+			case opPing:
+				select {
+				case control <- payload:
+				default:
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			ws.writeFrame(opClose, nil)
+			return
+		case <-s.done:
+			log.Printf("live: dropping slow client %s", r.RemoteAddr)
+			ws.writeFrame(opClose, nil)
+			return
+		case payload := <-control:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return
+			}
+		case msg := <-s.queue:
+			if err := ws.writeFrame(opText, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handler serves readings as server-sent events on /events and as websocket messages on /ws,
+// both accept repeated "stream" query parameters holding source glob patterns.
+func (f *fanout) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", f.events)
+	mux.HandleFunc("/ws", f.websocket)
+	return mux
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+// testSubscribed waits for a number of live subscribers.
+func testSubscribed(t *testing.T, f *fanout, n int) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		f.Lock()
+		found := len(f.subscribers)
+		f.Unlock()
+		if found == n {
+			return
+		}
+	}
+	t.Fatalf("expected %d live subscribers", n)
+}
+
+// testLive returns readings from two stations, only the first of which is subscribed to.
+func testLive() []raw.Reading {
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	return []raw.Reading{
+		{Source: "NZ_APIM_50_LFZ", Epoch: at, Value: 1},
+		{Source: "NZ_EYWM_50_LFZ", Epoch: at, Value: 2},
+		{Source: "NZ_APIM_50_LFZ", Epoch: at.Add(time.Second), Value: 3},
+	}
+}
+
+// maskedFrame encodes a client frame, optionally using the 64 bit length form for a short payload.
+func maskedFrame(op byte, payload []byte, long bool) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case long:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(n))
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	default:
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(n))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// dialWebsocket makes a websocket connection to the test server and checks the handshake.
+func dialWebsocket(t *testing.T, server *httptest.Server, target string) *websocket {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := bufio.NewReader(conn)
+	res, err := http.ReadResponse(rd, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("invalid upgrade status: %s", res.Status)
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("invalid websocket accept: %s", accept)
+	}
+
+	return &websocket{conn: conn, rd: rd}
+}
+
+func TestFanout_Events(t *testing.T) {
+
+	f := newFanout(16)
+	server := httptest.NewServer(f.handler())
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events?stream=NZ_APIM_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("invalid content type: %s", ct)
+	}
+
+	testSubscribed(t, f, 1)
+	f.publish(testLive())
+
+	scanner := bufio.NewScanner(res.Body)
+	for _, v := range []float64{1, 3} {
+		var data string
+		for data == "" && scanner.Scan() {
+			data = strings.TrimPrefix(scanner.Text(), "data: ")
+		}
+		var live liveReading
+		if err := json.Unmarshal([]byte(data), &live); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		if live.Source != "NZ_APIM_50_LFZ" || live.Value != v {
+			t.Errorf("invalid event, expected NZ_APIM_50_LFZ %g found %s %g", v, live.Source, live.Value)
+		}
+	}
+}
+
+func TestFanout_Websocket(t *testing.T) {
+
+	f := newFanout(16)
+	server := httptest.NewServer(f.handler())
+	defer server.Close()
+
+	ws := dialWebsocket(t, server, "/ws?stream=NZ_APIM_*")
+
+	testSubscribed(t, f, 1)
+	f.publish(testLive())
+
+	for _, v := range []float64{1, 3} {
+		op, payload, err := ws.readFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var live liveReading
+		if err := json.Unmarshal(payload, &live); op != opText || err != nil {
+			t.Fatalf("invalid message %x %q: %v", op, payload, err)
+		}
+		if live.Source != "NZ_APIM_50_LFZ" || live.Value != v {
+			t.Errorf("invalid message, expected NZ_APIM_50_LFZ %g found %s %g", v, live.Source, live.Value)
+		}
+	}
+
+	// masked pings in each length form are answered with the same payload
+	for _, v := range []struct {
+		size int
+		long bool
+	}{
+		{10, false},
+		{300, false},
+		{20, true},
+	} {
+		ping := []byte(strings.Repeat("p", v.size))
+		if _, err := ws.conn.Write(maskedFrame(opPing, ping, v.long)); err != nil {
+			t.Fatal(err)
+		}
+		op, payload, err := ws.readFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != opPong || string(payload) != string(ping) {
+			t.Errorf("%d byte ping: invalid reply %x of %d bytes", v.size, op, len(payload))
+		}
+	}
+
+	// a close frame ends the connection
+	if _, err := ws.conn.Write(maskedFrame(opClose, nil, false)); err != nil {
+		t.Fatal(err)
+	}
+	if op, _, err := ws.readFrame(); err != nil || op != opClose {
+		t.Errorf("expected a close frame, found %x: %v", op, err)
+	}
+	testSubscribed(t, f, 0)
+}
+
+func TestWebsocket_Frames(t *testing.T) {
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ws, peer := &websocket{conn: server}, &websocket{conn: client, rd: bufio.NewReader(client)}
+
+	// server frames use the shortest length form and are never masked
+	for _, v := range []struct {
+		size int
+		head []byte
+	}{
+		{125, []byte{0x81, 125}},
+		{126, []byte{0x81, 126, 0x00, 0x7e}},
+		{0xffff, []byte{0x81, 126, 0xff, 0xff}},
+		{0x10000, []byte{0x81, 127, 0, 0, 0, 0, 0, 0x01, 0x00, 0x00}},
+	} {
+		payload := []byte(strings.Repeat("x", v.size))
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- ws.writeFrame(opText, payload)
+		}()
+
+		head := make([]byte, len(v.head))
+		if _, err := peer.rd.Read(head[:1]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := peer.rd.Read(head[1:]); err != nil {
+			t.Fatal(err)
+		}
+		if string(head) != string(v.head) {
+			t.Errorf("%d bytes: invalid frame header, expected %x found %x", v.size, v.head, head)
+		}
+		body := make([]byte, v.size)
+		for n := 0; n < v.size; {
+			m, err := peer.rd.Read(body[n:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += m
+		}
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// client frames beyond the limit are refused
+	go client.Write(maskedFrame(opText, make([]byte, maxFramePayload+1), true))
+	if _, _, err := (&websocket{conn: server, rd: bufio.NewReader(server)}).readFrame(); err == nil {
+		t.Error("expected an oversized frame to be refused")
+	}
+}
+
+func TestFanout_SlowClient(t *testing.T) {
+
+	// large messages quickly fill the connection buffers of a client which never reads
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	readings := []raw.Reading{
+		{Source: "NZ_APIM_50_LFZ_" + strings.Repeat("x", 1<<16), Epoch: at, Value: 1},
+	}
+
+	for _, endpoint := range []string{"/events", "/ws"} {
+		f := newFanout(4)
+		f.timeout = 100 * time.Millisecond
+
+		exited := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(exited)
+			f.handler().ServeHTTP(w, r)
+		}))
+
+		switch endpoint {
+		case "/ws":
+			dialWebsocket(t, server, endpoint)
+		default:
+			res, err := http.Get(server.URL + endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+		}
+		testSubscribed(t, f, 1)
+
+		// the handler gives up on its blocked write once the client has been dropped
+		timeout := time.After(10 * time.Second)
+	loop:
+		for {
+			select {
+			case <-exited:
+				break loop
+			case <-timeout:
+				t.Fatalf("%s: handler did not exit for a slow client", endpoint)
+			case <-time.After(time.Millisecond):
+				f.publish(readings)
+			}
+		}
+		testSubscribed(t, f, 0)
+
+		server.Close()
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
-	"os"
+	"net/http"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/GeoNet/slink"
 	"github.com/ozym/raw"
+	"github.com/ozym/raw/internal/output"
+	"github.com/ozym/raw/seedlink"
 )
 
 func main() {
@@ -17,20 +23,22 @@ func main() {
 	// storage options
 	var dir string
 	flag.StringVar(&dir, "dir", ".", "output base directory")
-	var tmpl string
-	flag.StringVar(&tmpl, "template", "{{Year .Epoch}}/{{Year .Epoch}}.{{Doy .Epoch}}/{{Year .Epoch}}.{{Doy .Epoch}}.{{Hour .Epoch}}.{{.Source}}.csv", "file name template")
+	var out output.Flags
+	out.Register(flag.CommandLine)
 	var scale float64
 	flag.Float64Var(&scale, "scale", 1.0, "stream scale factor")
 	var offset float64
 	flag.Float64Var(&offset, "offset", 0.0, "stream offset factor")
-	var dp int
-	flag.IntVar(&dp, "dp", -1, "decimal places")
 
 	// seedlink options
 	var netdly int
 	flag.IntVar(&netdly, "netdly", 0, "provide network delay")
 	var netto int
 	flag.IntVar(&netto, "netto", 300, "provide network timeout")
+	var maxdly int
+	flag.IntVar(&maxdly, "maxdly", 600, "provide maximum reconnect delay after repeated failures")
+	var recheck time.Duration
+	flag.DurationVar(&recheck, "recheck", 10.0*time.Minute, "how often to try higher priority servers after a failover")
 	var keepalive int
 	flag.IntVar(&keepalive, "keepalive", 0, "provide keep-alive")
 	var selectors string
@@ -39,121 +47,289 @@ func main() {
 	var streams string
 	flag.StringVar(&streams, "streams", "*_*", "provide streams")
 	var statefile string
-	flag.StringVar(&statefile, "statefile", "", "provide a running state file")
+	flag.StringVar(&statefile, "statefile", "", "provide a running json state file, legacy libslink state files are converted")
 	var state time.Duration
 	flag.DurationVar(&state, "state", 30.0*time.Second, "how often to save state")
 
 	// heartbeat flush interval
 	var flush time.Duration
 	flag.DurationVar(&flush, "flush", 60.0*time.Second, "how often to update files")
+	var maxbuffer int
+	flag.IntVar(&maxbuffer, "maxbuffer", 1000000, "maximum number of buffered readings before an early flush, zero for no limit")
+	var maxstream int
+	flag.IntVar(&maxstream, "maxstream", 100000, "maximum number of buffered readings per stream before an early flush, zero for no limit")
+	var drain time.Duration
+	flag.DurationVar(&drain, "drain", 30.0*time.Second, "how long to wait for buffered readings to be stored on shutdown")
+
+	// storage failure options
+	var spooldir string
+	flag.StringVar(&spooldir, "spool", "", "provide a directory to spool unstored readings, otherwise, or if it can't be written, they are held in memory and state is not saved until they are stored")
+	var spoollimit int64
+	flag.Int64Var(&spoollimit, "spoollimit", 1<<30, "maximum spool size in bytes before the oldest readings are dropped")
+	var retry time.Duration
+	flag.DurationVar(&retry, "retry", 10.0*time.Second, "initial delay before retrying spooled readings")
+	var maxretry time.Duration
+	flag.DurationVar(&maxretry, "maxretry", 10.0*time.Minute, "maximum delay between retries of spooled readings")
+
+	// monitoring options
+	var listen string
+	flag.StringVar(&listen, "listen", "", "provide an http address for metrics and health checks")
+	var stale time.Duration
+	flag.DurationVar(&stale, "stale", 5.0*time.Minute, "how long without data before the health check fails")
+
+	// stream alerts
+	var streamstale time.Duration
+	flag.DurationVar(&streamstale, "streamstale", 0, "how long without data before an individual stream is reported as stale, zero to disable")
+	var alertexec string
+	flag.StringVar(&alertexec, "alertexec", "", "provide a command to run when a stream becomes stale or recovers")
+	var alerturl string
+	flag.StringVar(&alerturl, "alerturl", "", "provide a url to post json to when a stream becomes stale or recovers")
+
+	// live readings
+	var live string
+	flag.StringVar(&live, "live", "", "provide an http address to stream live readings as server-sent events and websocket messages")
+	var livequeue int
+	flag.IntVar(&livequeue, "livequeue", 1024, "number of readings queued for each live client before messages are dropped")
+
+	// replay options
+	var replayfiles bool
+	flag.BoolVar(&replayfiles, "replay", false, "replay the miniseed files given as arguments rather than connecting to seedlink servers")
+	var pace float64
+	flag.Float64Var(&pace, "pace", 1.0, "replay speed relative to real time, zero for no delay")
+
+	// multiple connections
+	var configfile string
+	flag.StringVar(&configfile, "config", "", "provide a json file describing several seedlink connections")
 
 	flag.Parse()
 
-	storage, err := raw.NewTemplate(tmpl)
+	storage, err := out.Output(flag.CommandLine)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// who to call ...
-	server := "localhost:18000"
-	if flag.NArg() > 0 {
-		server = flag.Arg(0)
+	// running statistics
+	stats := newMetrics()
+
+	if listen != "" {
+		go func() {
+			log.Printf("monitoring: %s", listen)
+			if err := http.ListenAndServe(listen, stats.handler(stale)); err != nil {
+				log.Fatalf("unable to serve metrics: %v", err)
+			}
+		}()
+	}
+
+	// optional live readings
+	var fan *fanout
+	if live != "" {
+		fan = newFanout(livequeue)
+		go func() {
+			log.Printf("live: %s", live)
+			if err := http.ListenAndServe(live, fan.handler()); err != nil {
+				log.Fatalf("unable to serve live readings: %v", err)
+			}
+		}()
+	}
+
+	// who to call, in priority order ...
+	servers := []string{"localhost:18000"}
+	if flag.NArg() > 0 && !replayfiles {
+		servers = flag.Args()
+	}
+
+	defaults := connection{
+		Name:      "seedlink",
+		Servers:   servers,
+		Streams:   streams,
+		Selectors: selectors,
+		StateFile: statefile,
+		Offset:    &offset,
+		Scale:     &scale,
+		NetTo:     &netto,
+		NetDly:    &netdly,
+		MaxDly:    &maxdly,
+		KeepAlive: &keepalive,
+		Recheck:   recheck.String(),
 	}
 
-	// initial seedlink handle
-	slconn := slink.NewSLCD()
-	defer slink.FreeSLCD(slconn)
+	connections := []*connection{&defaults}
+	if configfile != "" && !replayfiles {
+		if statefile != "" {
+			log.Fatal("-statefile can't be used with -config, give each connection its own statefile")
+		}
+		c, err := readConfig(configfile)
+		if err != nil {
+			log.Fatalf("unable to read config: %s: %v", configfile, err)
+		}
+		for n, conn := range c.Connections {
+			if conn.Name == "" {
+				conn.Name = fmt.Sprintf("seedlink-%d", n+1)
+			}
+			conn.defaults(defaults)
+		}
+		connections = c.Connections
+	}
+
+	var packets []seedlink.Packet
+	switch {
+	case replayfiles:
+		if configfile != "" {
+			log.Fatal("-config can't be used with -replay")
+		}
+		defaults.Name = "replay"
+		if err := defaults.open(stats); err != nil {
+			log.Fatalf("[%s] %v", defaults.Name, err)
+		}
+		if packets, err = readPackets(flag.Args()); err != nil {
+			log.Fatalf("unable to read replay files: %v", err)
+		}
+		packets = filterPackets(packets, defaults.client.Streams())
+		if n := len(packets); statefile != "" {
+			packets = resumePackets(packets, defaults.client.Streams())
+			log.Printf("[replay] resuming from state, skipping %d packets", n-len(packets))
+		}
+	default:
+		for _, c := range connections {
+			if err := c.open(stats); err != nil {
+				log.Fatalf("[%s] %v", c.Name, err)
+			}
+		}
+	}
 
-	// seedlink settings
-	slconn.SetNetDly(netdly)
-	slconn.SetNetTo(netto)
-	slconn.SetKeepAlive(keepalive)
+	// handle process signals via the context
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// conection
-	slconn.SetSLAddr(server)
-	defer slconn.Disconnect()
+	// optional per stream alerts
+	var alerts *monitor
+	if streamstale > 0 {
+		alerts = newMonitor(streamstale, alertexec, alerturl, stats)
+		go alerts.run(ctx)
+	}
 
-	// configure streams selectors to recover
-	slconn.ParseStreamList(streams, selectors)
+	// receivers -> decoder -> writer
+	records, batches, done := make(chan record, 1024), make(chan []raw.Reading, 1), make(chan struct{})
 
-	if statefile != "" {
-		if _, err := os.Stat(statefile); err == nil {
-			log.Println("read initial state")
-			if x := slconn.RecoverState(statefile); x != 0 {
-				log.Println("unable to read state: %s", statefile)
+	var receivers sync.WaitGroup
+	switch {
+	case replayfiles:
+		receivers.Add(1)
+		go func() {
+			defer receivers.Done()
+			if err := replay(ctx, &defaults, packets, pace, records, stats); err != nil && ctx.Err() == nil {
+				log.Printf("[replay] terminating: %v", err)
 			}
+		}()
+	default:
+		for _, c := range connections {
+			receivers.Add(1)
+			go func(c *connection) {
+				defer receivers.Done()
+				if err := receive(ctx, c, records, stats); err != nil && ctx.Err() == nil {
+					log.Printf("[%s] terminating: %v", c.Name, err)
+				}
+			}(c)
 		}
 	}
 
-	// handle process signals via channels
-	halt := make(chan os.Signal, 1)
-	signal.Notify(halt, syscall.SIGINT)
-	signal.Notify(halt, syscall.SIGTERM)
+	// the decoder drains once all receivers have finished
+	go func() {
+		receivers.Wait()
+		close(records)
+	}()
+
+	go decoder{
+		flush:  flush,
+		buffer: newBuffer(storage.Execute, maxbuffer, maxstream),
+		stats:  stats,
+		live:   fan,
+		alerts: alerts,
+
+		recordTime: replayfiles,
+	}.run(records, batches)
+
+	go func() {
+		defer close(done)
+		writer{
+			filename: storage.Execute,
+			store: func(file string, readings []raw.Reading) error {
+				return storage.Merge(filepath.Join(dir, file), readings)
+			},
+			stats: stats,
+			spool: &spool{
+				dir:   spooldir,
+				limit: spoollimit,
+				stats: stats,
+			},
+			retry:    retry,
+			maxRetry: maxretry,
+		}.run(batches)
+	}()
 
 	// periodicly save state
 	tick := time.NewTicker(state)
+	defer tick.Stop()
 
-	// periodicly flush the buffers
-	tock := time.NewTicker(flush)
-
-	var readings []raw.Reading
+	switch {
+	case replayfiles:
+		log.Printf("[replay] replaying: %s (%s) :: %d packets", streams, selectors, len(packets))
+	default:
+		for _, c := range connections {
+			log.Printf("[%s] collecting: %s (%s) :: %s", c.Name, c.Streams, c.Selectors, strings.Join(c.Servers, ","))
+		}
+	}
 
-	log.Printf("collecting: %s (%s) :: %s", streams, selectors, server)
+	var holding bool
 
 loop:
 	for {
 		select {
-		case <-halt:
+		case <-ctx.Done():
+			log.Printf("terminating")
+			break loop
+		case <-done:
 			break loop
 		case <-tick.C:
-			if statefile != "" {
-				if x := slconn.SaveState(statefile); x != 0 {
-					log.Fatalf("unable to write state: %s", statefile)
-				}
-			}
-		case <-tock.C:
-			if len(readings) > 0 {
-				log.Printf("flush: %d records", len(readings))
-				if err := raw.Store(dir, raw.NewCsv(dp), storage.Execute, readings); err != nil {
-					log.Fatalf("unable to store readings: %v", err)
+			// readings spooled in memory would be lost on a restart, so hold the state
+			// back until they are stored rather than resume past them
+			if n := stats.spooledInMemory(); n > 0 {
+				if !holding {
+					log.Printf("holding state while %d batches are spooled in memory", n)
 				}
-				readings = nil
+				holding = true
+				continue
 			}
-		default:
-			// recover packet ...
-			switch p, rc := slconn.CollectNB(); rc {
-			case slink.SLTERMINATE:
-				log.Printf("terminating")
-				break loop
-			case slink.SLNOPACKET:
-				time.Sleep(100 * time.Millisecond)
-				continue loop
-			case slink.SLPACKET:
-				// check just in case we're shutting down
-				if p != nil && p.PacketType() == slink.SLDATA {
-					r, err := raw.DecodeMSeedBuffer(p.GetMSRecord(), offset, scale)
-					if err != nil {
-						log.Fatalf("unable to decode mseed buffer: %v", err)
-					}
-					readings = append(readings, r...)
+			holding = false
+			for _, c := range connections {
+				if err := c.saveState(); err != nil {
+					log.Fatalf("[%s] unable to write state: %s: %v", c.Name, c.StateFile, err)
 				}
-			default:
-				log.Fatal("invalid packet")
 			}
 		}
 	}
 
-	if len(readings) > 0 {
-		log.Printf("flush: %d records", len(readings))
-		if err := raw.Store(dir, raw.NewCsv(dp), storage.Execute, readings); err != nil {
-			log.Fatalf("unable to store readings: %v", err)
-		}
+	// stop collecting and wait for the pipeline to drain
+	stop()
+
+	select {
+	case <-done:
+	case <-time.After(drain):
+		log.Fatalf("unable to store buffered readings within %s", drain)
 	}
 
-	if statefile != "" {
-		log.Println("write final state")
-		if x := slconn.SaveState(statefile); x != 0 {
-			log.Fatalf("unable to write state: %s", statefile)
+	if n := stats.spooledInMemory(); n > 0 {
+		log.Printf("not writing final state, %d batches were discarded", n)
+		connections = nil
+	}
+
+	for _, c := range connections {
+		if c.StateFile == "" || c.client == nil {
+			continue
+		}
+		log.Printf("[%s] write final state", c.Name)
+		if err := c.saveState(); err != nil {
+			log.Fatalf("[%s] unable to write state: %s: %v", c.Name, c.StateFile, err)
 		}
 	}
 
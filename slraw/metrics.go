@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type streamMetrics struct {
+	packets int64
+	last    time.Time
+	latency time.Duration
+
+	sample time.Time
+	stale  bool
+}
+
+// metrics collects running counters which are exposed in the prometheus text format.
+type metrics struct {
+	sync.Mutex
+
+	start   time.Time
+	streams map[string]*streamMetrics
+
+	decodeErrors  int64
+	buffered      int64
+	flushes       int64
+	flushDuration time.Duration
+	storeFailures int64
+	connErrors    int64
+
+	spoolBatches int64
+	spoolBytes   int64
+	spoolMemory  int64
+	spoolDropped int64
+	spoolErrors  int64
+	storeDropped int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		start:   time.Now(),
+		streams: make(map[string]*streamMetrics),
+	}
+}
+
+func (m *metrics) packet(stream string, end time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	s, ok := m.streams[stream]
+	if !ok {
+		s = &streamMetrics{}
+		m.streams[stream] = s
+	}
+	s.packets++
+	s.last = time.Now()
+	s.latency = s.last.Sub(end)
+}
+
+func (m *metrics) sample(stream string, at time.Time, stale bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	s, ok := m.streams[stream]
+	if !ok {
+		s = &streamMetrics{}
+		m.streams[stream] = s
+	}
+	s.sample, s.stale = at, stale
+}
+
+func (m *metrics) decodeError() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.decodeErrors++
+}
+
+func (m *metrics) setBuffered(n int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.buffered = int64(n)
+}
+
+func (m *metrics) flushed(d time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.flushes++
+	m.flushDuration = d
+	if err != nil {
+		m.storeFailures++
+	}
+}
+
+func (m *metrics) setSpool(batches int, size int64, memory int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.spoolBatches, m.spoolBytes, m.spoolMemory = int64(batches), size, int64(memory)
+}
+
+// spooled returns the number of batches waiting in the spool.
+func (m *metrics) spooled() int64 {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.spoolBatches
+}
+
+// spooledInMemory returns the number of spooled batches which would be lost on a restart.
+func (m *metrics) spooledInMemory() int64 {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.spoolMemory
+}
+
+func (m *metrics) dropped(n int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.spoolDropped += int64(n)
+}
+
+func (m *metrics) spoolError() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.spoolErrors++
+}
+
+func (m *metrics) unstorable(n int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.storeDropped += int64(n)
+}
+
+func (m *metrics) connectionError() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.connErrors++
+}
+
+// lastPacket returns the most recent packet arrival time, or the start time if nothing has arrived.
+func (m *metrics) lastPacket() time.Time {
+	m.Lock()
+	defer m.Unlock()
+
+	last := m.start
+	for _, s := range m.streams {
+		if s.last.After(last) {
+			last = s.last
+		}
+	}
+	return last
+}
+
+func (m *metrics) WriteTo(wr io.Writer) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var b strings.Builder
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	keys := make([]string, 0, len(m.streams))
+	for k := range m.streams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	metric("slraw_packets_received_total", "counter", "Number of seedlink data packets received.")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "slraw_packets_received_total{stream=\"%s\"} %d\n", labelEscaper.Replace(k), m.streams[k].packets)
+	}
+	metric("slraw_last_packet_timestamp_seconds", "gauge", "Arrival time of the most recent packet.")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "slraw_last_packet_timestamp_seconds{stream=\"%s\"} %.3f\n", labelEscaper.Replace(k), float64(m.streams[k].last.UnixNano())/1e9)
+	}
+	metric("slraw_packet_latency_seconds", "gauge", "Delay between the last sample of the most recent packet and its arrival.")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "slraw_packet_latency_seconds{stream=\"%s\"} %.3f\n", labelEscaper.Replace(k), m.streams[k].latency.Seconds())
+	}
+
+	metric("slraw_last_sample_timestamp_seconds", "gauge", "Time of the most recent decoded sample.")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "slraw_last_sample_timestamp_seconds{stream=\"%s\"} %.3f\n", labelEscaper.Replace(k), float64(m.streams[k].sample.UnixNano())/1e9)
+	}
+	metric("slraw_stream_stale", "gauge", "Whether a stream has exceeded the stale threshold.")
+	for _, k := range keys {
+		var stale int
+		if m.streams[k].stale {
+			stale = 1
+		}
+		fmt.Fprintf(&b, "slraw_stream_stale{stream=\"%s\"} %d\n", labelEscaper.Replace(k), stale)
+	}
+
+	metric("slraw_decode_errors_total", "counter", "Number of packets which could not be decoded.")
+	fmt.Fprintf(&b, "slraw_decode_errors_total %d\n", m.decodeErrors)
+	metric("slraw_readings_buffered", "gauge", "Number of readings waiting to be stored.")
+	fmt.Fprintf(&b, "slraw_readings_buffered %d\n", m.buffered)
+	metric("slraw_flushes_total", "counter", "Number of attempts to store buffered readings.")
+	fmt.Fprintf(&b, "slraw_flushes_total %d\n", m.flushes)
+	metric("slraw_flush_duration_seconds", "gauge", "Time taken by the most recent flush.")
+	fmt.Fprintf(&b, "slraw_flush_duration_seconds %.3f\n", m.flushDuration.Seconds())
+	metric("slraw_store_failures_total", "counter", "Number of flushes which failed to store readings.")
+	fmt.Fprintf(&b, "slraw_store_failures_total %d\n", m.storeFailures)
+	metric("slraw_store_dropped_readings_total", "counter", "Number of readings dropped as they can never be stored.")
+	fmt.Fprintf(&b, "slraw_store_dropped_readings_total %d\n", m.storeDropped)
+	metric("slraw_connection_errors_total", "counter", "Number of failed or dropped seedlink connections.")
+	fmt.Fprintf(&b, "slraw_connection_errors_total %d\n", m.connErrors)
+	metric("slraw_spool_batches", "gauge", "Number of batches waiting in the spool.")
+	fmt.Fprintf(&b, "slraw_spool_batches %d\n", m.spoolBatches)
+	metric("slraw_spool_bytes", "gauge", "Size of the spool in bytes.")
+	fmt.Fprintf(&b, "slraw_spool_bytes %d\n", m.spoolBytes)
+	metric("slraw_spool_memory_batches", "gauge", "Number of spooled batches held in memory.")
+	fmt.Fprintf(&b, "slraw_spool_memory_batches %d\n", m.spoolMemory)
+	metric("slraw_spool_errors_total", "counter", "Number of batches which could not be written to the spool directory and were held in memory.")
+	fmt.Fprintf(&b, "slraw_spool_errors_total %d\n", m.spoolErrors)
+	metric("slraw_spool_dropped_readings_total", "counter", "Number of readings dropped once the spool was full.")
+	fmt.Fprintf(&b, "slraw_spool_dropped_readings_total %d\n", m.spoolDropped)
+
+	n, err := io.WriteString(wr, b.String())
+	return int64(n), err
+}
+
+// handler serves the metrics and a health check which fails if no data has arrived within the stale window.
+func (m *metrics) handler(stale time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.WriteTo(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if last := m.lastPacket(); stale > 0 && time.Since(last) > stale {
+			http.Error(w, fmt.Sprintf("no data since %s", last.UTC().Format(time.RFC3339)), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
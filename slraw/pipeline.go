@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ozym/raw"
+	"github.com/ozym/raw/seedlink"
+)
+
+// record is a received packet together with the calibration of its connection.
+type record struct {
+	seedlink.Packet
+
+	offset float64
+	scale  float64
+}
+
+// receive passes seedlink packets on to the decoder until the collection finishes.
+func receive(ctx context.Context, conn *connection, records chan<- record, stats *metrics) error {
+	return conn.client.Collect(ctx, func(p seedlink.Packet) error {
+		stats.packet(p.Header.SrcName(), p.Header.EndTime())
+		select {
+		case records <- record{Packet: p, offset: *conn.Offset, scale: *conn.Scale}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+type decoder struct {
+	flush  time.Duration
+	buffer *buffer
+	stats  *metrics
+	live   *fanout
+	alerts *monitor
+
+	// flush as record times cross each interval rather than by the clock, as replays run at any pace
+	recordTime bool
+}
+
+// run converts packets into readings which are handed to the writer at each flush interval, or earlier
+// if the buffer releases them, it blocks if the writer is still busy with a previous batch. The batches
+// channel is closed once the records have been drained.
+func (d decoder) run(records <-chan record, batches chan<- []raw.Reading) {
+	defer close(batches)
+
+	// a nil channel never ticks when flushing by record time
+	var ticks <-chan time.Time
+	if !d.recordTime {
+		tock := time.NewTicker(d.flush)
+		defer tock.Stop()
+		ticks = tock.C
+	}
+
+	var next time.Time
+	for {
+		select {
+		case p, ok := <-records:
+			if !ok {
+				if readings := d.buffer.Flush(); len(readings) > 0 {
+					batches <- readings
+				}
+				return
+			}
+			if at := p.Header.StartTime; d.recordTime && d.flush > 0 && !at.Before(next) {
+				if readings := d.buffer.Flush(); len(readings) > 0 {
+					batches <- readings
+				}
+				next = at.Truncate(d.flush).Add(d.flush)
+			}
+			r, err := raw.DecodeMSeedBuffer(p.Record, p.offset, p.scale)
+			if err != nil {
+				log.Printf("unable to decode mseed buffer: %s: %v", p.Header.SrcName(), err)
+				d.stats.decodeError()
+				continue
+			}
+			d.live.publish(r)
+			d.alerts.observe(r)
+			if readings := d.buffer.Add(r); len(readings) > 0 {
+				batches <- readings
+			}
+		case <-ticks:
+			if readings := d.buffer.Flush(); len(readings) > 0 {
+				batches <- readings
+			}
+		}
+		d.stats.setBuffered(d.buffer.Len())
+	}
+}
+
+type writer struct {
+	// filename names the file a reading belongs in, and store merges readings into one of these files
+	filename func(raw.Reading) (string, error)
+	store    func(string, []raw.Reading) error
+
+	stats *metrics
+	spool *spool
+
+	// initial and maximum delays between attempts to store spooled readings
+	retry    time.Duration
+	maxRetry time.Duration
+}
+
+// temporary reports whether a storage error is from the file system and may clear up by itself,
+// rather than coming from the readings, the codec or an existing file which can't be merged.
+func temporary(err error) bool {
+	var path *os.PathError
+	var link *os.LinkError
+	var call *os.SyscallError
+	return errors.As(err, &path) || errors.As(err, &link) || errors.As(err, &call)
+}
+
+// flush stores readings file by file and returns those in files which failed with a temporary
+// error, readings which can never be stored are dropped so they don't hold up everything else.
+func (w writer) flush(readings []raw.Reading) ([]raw.Reading, error) {
+	log.Printf("flush: %d records", len(readings))
+
+	start := time.Now()
+
+	var names []string
+	files := make(map[string][]raw.Reading)
+	for _, r := range readings {
+		name, err := w.filename(r)
+		if err != nil {
+			log.Printf("dropping reading: %s: %v", r.Source, err)
+			w.stats.unstorable(1)
+			continue
+		}
+		if _, ok := files[name]; !ok {
+			names = append(names, name)
+		}
+		files[name] = append(files[name], r)
+	}
+
+	var failed []raw.Reading
+	var last error
+	for _, name := range names {
+		switch err := w.store(name, files[name]); {
+		case err == nil:
+		case temporary(err):
+			failed, last = append(failed, files[name]...), err
+		default:
+			log.Printf("dropping %d readings which can't be stored: %v", len(files[name]), err)
+			w.stats.unstorable(len(files[name]))
+		}
+	}
+
+	w.stats.flushed(time.Since(start), last)
+
+	return failed, last
+}
+
+// retried stores a spooled batch, which stays spooled as a whole if any of its files still fail.
+func (w writer) retried(readings []raw.Reading) error {
+	_, err := w.flush(readings)
+	return err
+}
+
+// run stores each batch of readings until the batches channel is closed, readings which can't
+// be stored yet are spooled and retried with an increasing delay.
+func (w writer) run(batches <-chan []raw.Reading) {
+	delay := w.retry
+
+	retry := time.NewTimer(delay)
+	defer retry.Stop()
+
+	// a nil channel blocks until there is something to retry
+	var retries <-chan time.Time
+	if !w.spool.empty() {
+		log.Printf("retrying spooled readings: %s", w.spool)
+		retries = retry.C
+	}
+
+	for {
+		select {
+		case readings, ok := <-batches:
+			if !ok {
+				if !w.spool.empty() {
+					if err := w.spool.drain(w.retried); err != nil {
+						log.Printf("unable to store spooled readings on shutdown: %v", err)
+					}
+				}
+				if n := len(w.spool.pending); n > 0 {
+					log.Printf("discarding %d unstored batches held in memory", n)
+				}
+				return
+			}
+			if failed, err := w.flush(readings); len(failed) > 0 {
+				log.Printf("unable to store %d readings, spooling: %v", len(failed), err)
+				w.spool.add(failed)
+				if retries == nil {
+					retry.Reset(delay)
+					retries = retry.C
+				}
+			}
+		case <-retries:
+			if err := w.spool.drain(w.retried); err != nil {
+				if delay *= 2; w.maxRetry > 0 && delay > w.maxRetry {
+					delay = w.maxRetry
+				}
+				log.Printf("unable to store spooled readings, retrying in %s: %v", delay, err)
+				retry.Reset(delay)
+				continue
+			}
+			delay, retries = w.retry, nil
+		}
+	}
+}
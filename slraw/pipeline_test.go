@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ozym/raw"
+	"github.com/ozym/raw/seedlink"
+)
+
+const testFile = "../testdata/NZ.APIM.50.LFZ.D.2016.215"
+
+const testTemplate = "{{.Source}}/{{Year .Epoch}}.{{Doy .Epoch}}.{{Hour .Epoch}}.csv"
+
+// testServer replays packets on the given address until it is stopped.
+func testServer(t *testing.T, addr string, packets []seedlink.Packet, disconnects ...int) (string, func()) {
+	server := seedlink.NewServer()
+	server.Disconnects = disconnects
+	for _, p := range packets {
+		if err := server.Add(p.Record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Serve(ctx, l)
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+
+	return l.Addr().String(), stop
+}
+
+func testConnection(t *testing.T, addr, state string, stats *metrics) *connection {
+	offset, scale, netto, zero := 0.0, 1.0, 5, 0
+
+	conn := &connection{
+		Name:      "test",
+		Servers:   []string{addr},
+		Streams:   "NZ_APIM",
+		Selectors: "???",
+		StateFile: state,
+		Offset:    &offset,
+		Scale:     &scale,
+		NetTo:     &netto,
+		NetDly:    &zero,
+		MaxDly:    &zero,
+		KeepAlive: &zero,
+		Recheck:   "0s",
+	}
+	if err := conn.open(stats); err != nil {
+		t.Fatal(err)
+	}
+
+	// finish once the server has sent everything
+	conn.client.NetDly, conn.client.Fetch = 10*time.Millisecond, true
+
+	return conn
+}
+
+// testPipeline runs a collection through the decoder and writer until it has been stored.
+func testPipeline(t *testing.T, conn *connection, dir string, stats *metrics) {
+	storage, err := raw.NewTemplate(testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records, batches, done := make(chan record, 1024), make(chan []raw.Reading, 1), make(chan struct{})
+
+	go func() {
+		defer close(records)
+		if err := receive(ctx, conn, records, stats); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	go decoder{
+		flush:  time.Minute,
+		buffer: newBuffer(storage.Execute, 0, 0),
+		stats:  stats,
+	}.run(records, batches)
+
+	go func() {
+		defer close(done)
+		writer{
+			filename: storage.Execute,
+			store: func(file string, readings []raw.Reading) error {
+				_, err := raw.MergeFile(filepath.Join(dir, file), raw.Csv{}, readings)
+				return err
+			},
+			stats: stats,
+			spool: &spool{stats: stats},
+			retry: time.Second,
+		}.run(batches)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("pipeline did not finish")
+	}
+}
+
+// testReadings returns the stored or expected readings keyed by source and time.
+func testReadings(readings []raw.Reading) map[string]float64 {
+	found := make(map[string]float64)
+	for _, r := range readings {
+		found[r.Source+" "+r.Epoch.Format(time.RFC3339Nano)] = r.Value
+	}
+	return found
+}
+
+func storedReadings(t *testing.T, dir string) map[string]float64 {
+	var readings []raw.Reading
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		r, err := raw.ReadFile(path, raw.Csv{})
+		if err != nil {
+			return err
+		}
+		readings = append(readings, r...)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return testReadings(readings)
+}
+
+func TestPipeline_Resume(t *testing.T) {
+
+	f, err := os.Open(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var packets []seedlink.Packet
+	if err := seedlink.ReadRecords(f, func(h seedlink.Header, record []byte) error {
+		packets = append(packets, seedlink.Packet{Header: h, Record: append([]byte{}, record...)})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) < 100 {
+		t.Fatalf("not enough test packets: %d", len(packets))
+	}
+
+	var expected []raw.Reading
+	for _, p := range packets {
+		r, err := raw.DecodeMSeedBuffer(p.Record, 0.0, 1.0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, r...)
+	}
+
+	dir, state := t.TempDir(), filepath.Join(t.TempDir(), "state.json")
+
+	// the server drops the connection part way through the first run
+	addr, stop := testServer(t, "127.0.0.1:0", packets[:100], 50)
+
+	first := newMetrics()
+	conn := testConnection(t, addr, state, first)
+	testPipeline(t, conn, dir, first)
+	if err := conn.saveState(); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if n := first.streams["NZ_APIM_50_LFZ"].packets; n != 100 {
+		t.Errorf("invalid number of packets in the first run, expected %d found %d", 100, n)
+	}
+
+	// a restart resumes from the state file
+	rest := newMetrics()
+	addr, _ = testServer(t, addr, packets)
+	conn = testConnection(t, addr, state, rest)
+	testPipeline(t, conn, dir, rest)
+	if n := rest.streams["NZ_APIM_50_LFZ"].packets; n != int64(len(packets)-100) {
+		t.Errorf("invalid number of packets after resuming, expected %d found %d", len(packets)-100, n)
+	}
+
+	want, found := testReadings(expected), storedReadings(t, dir)
+	if len(found) != len(want) {
+		t.Errorf("invalid number of stored readings, expected %d found %d", len(want), len(found))
+	}
+	for k, v := range want {
+		if x, ok := found[k]; !ok || x != v {
+			t.Errorf("invalid stored reading %s, expected %g found %g", k, v, x)
+			break
+		}
+	}
+}
+
+func TestWriter_Retry(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	readings := []raw.Reading{
+		{Source: "NZ_APIM_50_LFZ", Epoch: at, Value: 1},
+		{Source: "NZ_APIM_50_LFZ", Epoch: at.Add(time.Second), Value: 2},
+	}
+
+	for _, dir := range []string{"", t.TempDir()} {
+		stats := newMetrics()
+
+		// storage fails twice before recovering
+		var attempts int
+		var stored []raw.Reading
+		storedc := make(chan struct{})
+
+		batches, done := make(chan []raw.Reading), make(chan struct{})
+		go func() {
+			defer close(done)
+			writer{
+				filename: func(raw.Reading) (string, error) {
+					return "test.csv", nil
+				},
+				store: func(file string, r []raw.Reading) error {
+					if attempts++; attempts <= 2 {
+						return &os.PathError{Op: "write", Path: file, Err: syscall.ENOSPC}
+					}
+					stored = append(stored, r...)
+					close(storedc)
+					return nil
+				},
+				stats:    stats,
+				spool:    &spool{dir: dir, stats: stats},
+				retry:    10 * time.Millisecond,
+				maxRetry: 20 * time.Millisecond,
+			}.run(batches)
+		}()
+
+		batches <- readings
+
+		select {
+		case <-storedc:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("spool %q: spooled readings were not retried", dir)
+		}
+
+		close(batches)
+		<-done
+
+		if attempts != 3 {
+			t.Errorf("spool %q: invalid number of store attempts, expected %d found %d", dir, 3, attempts)
+		}
+		if len(stored) != len(readings) {
+			t.Errorf("spool %q: invalid number of stored readings, expected %d found %d", dir, len(readings), len(stored))
+		}
+		if n := stats.spooled(); n != 0 {
+			t.Errorf("spool %q: expected an empty spool, found %d batches", dir, n)
+		}
+	}
+}
+
+func TestWriter_Unstorable(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	readings := []raw.Reading{
+		{Source: "NZ_APIM_50_LFZ", Epoch: at, Value: 1},
+		{Source: "NZ_EYWM_50_LFZ", Epoch: at, Value: 2},
+		{Source: "NZ_EYWM_50_LFZ", Epoch: at.Add(time.Second), Value: 3},
+		{Source: "NZ_SMHS_50_LFZ", Epoch: at, Value: 4},
+	}
+
+	stats := newMetrics()
+	stored := make(map[string]int)
+
+	w := writer{
+		filename: func(r raw.Reading) (string, error) {
+			return r.Source + ".csv", nil
+		},
+		store: func(file string, r []raw.Reading) error {
+			switch file {
+			case "NZ_EYWM_50_LFZ.csv":
+				return errors.New("too many channels")
+			case "NZ_SMHS_50_LFZ.csv":
+				return &os.PathError{Op: "open", Path: file, Err: syscall.EACCES}
+			}
+			stored[file] += len(r)
+			return nil
+		},
+		stats: stats,
+		spool: &spool{stats: stats},
+	}
+
+	// only the file system failure is kept for another attempt
+	failed, err := w.flush(readings)
+	if err == nil {
+		t.Error("expected a temporary store error")
+	}
+	if len(failed) != 1 || failed[0].Source != "NZ_SMHS_50_LFZ" {
+		t.Errorf("invalid readings to spool: %v", failed)
+	}
+	if n := stored["NZ_APIM_50_LFZ.csv"]; n != 1 {
+		t.Errorf("invalid number of stored readings, expected %d found %d", 1, n)
+	}
+	if stats.storeDropped != 2 {
+		t.Errorf("invalid number of dropped readings, expected %d found %d", 2, stats.storeDropped)
+	}
+	if stats.storeFailures != 1 {
+		t.Errorf("invalid number of store failures, expected %d found %d", 1, stats.storeFailures)
+	}
+}
+
+func TestSpool_Fallback(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	readings := []raw.Reading{
+		{Source: "NZ_APIM_50_LFZ", Epoch: at, Value: 1},
+	}
+
+	// a file where the spool directory should be can't be written into
+	dir := filepath.Join(t.TempDir(), "spool")
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := newMetrics()
+	s := &spool{dir: dir, stats: stats}
+
+	s.add(readings)
+	if n := stats.spooledInMemory(); n != 1 {
+		t.Errorf("invalid number of batches held in memory, expected %d found %d", 1, n)
+	}
+	if stats.spoolErrors != 1 {
+		t.Errorf("invalid number of spool errors, expected %d found %d", 1, stats.spoolErrors)
+	}
+
+	var stored []raw.Reading
+	if err := s.drain(func(r []raw.Reading) error {
+		stored = append(stored, r...)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(readings) {
+		t.Errorf("invalid number of drained readings, expected %d found %d", len(readings), len(stored))
+	}
+	if n := stats.spooledInMemory(); n != 0 {
+		t.Errorf("expected nothing held in memory, found %d batches", n)
+	}
+}
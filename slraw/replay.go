@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ozym/raw/seedlink"
+)
+
+// readPackets loads miniseed records from files, ordered by their start times.
+func readPackets(files []string) ([]seedlink.Packet, error) {
+	var packets []seedlink.Packet
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		err = seedlink.ReadRecords(f, func(h seedlink.Header, buf []byte) error {
+			packets = append(packets, seedlink.Packet{
+				Header: h,
+				Record: append([]byte{}, buf...),
+			})
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(packets, func(i, j int) bool {
+		return packets[i].Header.StartTime.Before(packets[j].Header.StartTime)
+	})
+	for i := range packets {
+		packets[i].Sequence = i + 1
+	}
+
+	return packets, nil
+}
+
+// filterPackets keeps packets matching the stream list, as a seedlink server would.
+func filterPackets(packets []seedlink.Packet, streams []seedlink.Stream) []seedlink.Packet {
+	var found []seedlink.Packet
+	for _, p := range packets {
+		for _, s := range streams {
+			if !s.Match(p.Header.Network, p.Header.Station) {
+				continue
+			}
+			if seedlink.MatchSelectors(s.Selectors, p.Header.Location, p.Header.Channel) {
+				found = append(found, p)
+			}
+			break
+		}
+	}
+	return found
+}
+
+// replayServer is recorded as the server in state files written by a replay, so the sequence
+// numbers, which only count the replayed packets, are never used to resume from a real server.
+const replayServer = "replay"
+
+// resumePackets drops packets which end before the recovered state of their stream, so a replay
+// restarted with the same state file carries on from where it stopped.
+func resumePackets(packets []seedlink.Packet, streams []seedlink.Stream) []seedlink.Packet {
+	var found []seedlink.Packet
+	for _, p := range packets {
+		for _, s := range streams {
+			if !s.Match(p.Header.Network, p.Header.Station) {
+				continue
+			}
+			if s.Timestamp.IsZero() || p.Header.EndTime().After(s.Timestamp) {
+				found = append(found, p)
+			}
+			break
+		}
+	}
+	return found
+}
+
+// replay injects packets into the pipeline as though they had been received, paced relative
+// to their record times, a pace of zero sends them as fast as possible. The connection state
+// follows the replayed packets.
+func replay(ctx context.Context, conn *connection, packets []seedlink.Packet, pace float64, records chan<- record, stats *metrics) error {
+	var first time.Time
+	start := time.Now()
+
+	for _, p := range packets {
+		if pace > 0 {
+			if first.IsZero() {
+				first = p.Header.StartTime
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Until(start.Add(time.Duration(float64(p.Header.StartTime.Sub(first)) / pace)))):
+			}
+		}
+
+		conn.client.Update(replayServer, p)
+		stats.packet(p.Header.SrcName(), p.Header.EndTime())
+		select {
+		case records <- record{Packet: p, offset: *conn.Offset, scale: *conn.Scale}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozym/raw"
+	"github.com/ozym/raw/seedlink"
+)
+
+func TestReplay_Filter(t *testing.T) {
+
+	packets, err := readPackets([]string{testFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		streams   string
+		selectors string
+		all       bool
+	}{
+		{"*_*", "???", true},
+		{"NZ_APIM", "50LFZ", true},
+		{"NZ_APIM:LF?", "LFX", true},
+		{"NZ_APIM", "51LFZ", false},
+		{"NZ_APIM", "!LF?", false},
+		{"NZ_SBAM", "???", false},
+	} {
+		list, err := seedlink.ParseStreamList(v.streams, v.selectors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := filterPackets(packets, list)
+		switch {
+		case v.all && len(found) != len(packets):
+			t.Errorf("%s (%s): expected all %d packets, found %d", v.streams, v.selectors, len(packets), len(found))
+		case !v.all && len(found) != 0:
+			t.Errorf("%s (%s): expected no packets, found %d", v.streams, v.selectors, len(found))
+		}
+	}
+}
+
+func TestReplay_State(t *testing.T) {
+
+	packets, err := readPackets([]string{testFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) < 100 {
+		t.Fatalf("not enough test packets: %d", len(packets))
+	}
+
+	state := filepath.Join(t.TempDir(), "state.json")
+
+	stats := newMetrics()
+	conn := testConnection(t, "127.0.0.1:0", state, stats)
+
+	records := make(chan record, len(packets))
+	if err := replay(context.Background(), conn, packets[:100], 0, records, stats); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := seedlink.ReadStateFile(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, ok := saved.Stream("NZ", "APIM")
+	if !ok {
+		t.Fatal("missing replay state")
+	}
+	if ss.Server != replayServer || ss.Sequence != 100 {
+		t.Errorf("invalid replay state, expected %s #%d found %s #%d", replayServer, 100, ss.Server, ss.Sequence)
+	}
+	if ss.Time == nil || !ss.Time.Equal(packets[99].Header.EndTime()) {
+		t.Errorf("invalid replay state time, expected %s found %v", packets[99].Header.EndTime(), ss.Time)
+	}
+
+	// a restart carries on after the saved time
+	conn = testConnection(t, "127.0.0.1:0", state, newMetrics())
+	rest := resumePackets(packets, conn.client.Streams())
+	if len(rest) != len(packets)-100 {
+		t.Fatalf("invalid number of packets to resume, expected %d found %d", len(packets)-100, len(rest))
+	}
+	if rest[0].Sequence != 101 {
+		t.Errorf("invalid first resumed packet, expected #%d found #%d", 101, rest[0].Sequence)
+	}
+}
+
+func TestDecoder_RecordTime(t *testing.T) {
+
+	packets, err := readPackets([]string{testFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a batch for each hour of records, however fast they arrive
+	hours := make(map[time.Time]bool)
+	for _, p := range packets {
+		hours[p.Header.StartTime.Truncate(time.Hour)] = true
+	}
+
+	storage, err := raw.NewTemplate(testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, batches := make(chan record, len(packets)), make(chan []raw.Reading)
+	for _, p := range packets {
+		records <- record{Packet: p, scale: 1.0}
+	}
+	close(records)
+
+	go decoder{
+		flush:      time.Hour,
+		buffer:     newBuffer(storage.Execute, 0, 0),
+		stats:      newMetrics(),
+		recordTime: true,
+	}.run(records, batches)
+
+	var n int
+	for range batches {
+		n++
+	}
+	if n != len(hours) {
+		t.Errorf("invalid number of batches, expected %d found %d", len(hours), n)
+	}
+}
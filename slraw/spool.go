@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ozym/raw"
+)
+
+// approximate in-memory cost of a reading when no spool directory is given
+const readingSize = 64
+
+// spool holds batches of readings which could not be stored, either as files in a
+// directory so they survive a restart, or in memory if there is no directory or it
+// can't be written.
+type spool struct {
+	dir   string
+	limit int64
+	stats *metrics
+
+	pending [][]raw.Reading
+	warned  int64
+}
+
+type spoolFile struct {
+	path string
+	size int64
+}
+
+func (s *spool) files() ([]spoolFile, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(s.dir, "spool-*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	var files []spoolFile
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, spoolFile{path: m, size: info.Size()})
+	}
+
+	return files, nil
+}
+
+// size returns the number of spooled batches and their total size in bytes.
+func (s *spool) size() (int, int64) {
+	files, err := s.files()
+	if err != nil {
+		log.Printf("unable to list spool: %v", err)
+	}
+
+	var n int64
+	for _, f := range files {
+		n += f.size
+	}
+	for _, p := range s.pending {
+		n += int64(len(p)) * readingSize
+	}
+	return len(files) + len(s.pending), n
+}
+
+// add spools a batch of readings, if the spool directory can't be written they are held in memory instead.
+func (s *spool) add(readings []raw.Reading) {
+	switch s.dir {
+	case "":
+		s.pending = append(s.pending, readings)
+	default:
+		name := "spool-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".csv"
+		if err := raw.WriteFile(filepath.Join(s.dir, name), raw.Csv{}, readings); err != nil {
+			log.Printf("unable to spool readings, holding them in memory: %v", err)
+			s.stats.spoolError()
+			s.pending = append(s.pending, readings)
+		}
+	}
+
+	s.check()
+}
+
+// check drops the oldest batches beyond the size limit and warns as the spool grows.
+func (s *spool) check() {
+	count, size := s.size()
+
+	for s.limit > 0 && size > s.limit && count > 1 {
+		files, err := s.files()
+		if err != nil {
+			log.Printf("unable to trim spool: %v", err)
+			return
+		}
+
+		var dropped int
+		switch {
+		case len(files) > 0:
+			if r, err := raw.ReadFile(files[0].path, raw.Csv{}); err == nil {
+				dropped = len(r)
+			}
+			if err := os.Remove(files[0].path); err != nil {
+				log.Printf("unable to trim spool: %v", err)
+				return
+			}
+		default:
+			dropped, s.pending = len(s.pending[0]), s.pending[1:]
+		}
+		log.Printf("spool limit of %d bytes exceeded, dropped %d readings", s.limit, dropped)
+		s.stats.dropped(dropped)
+
+		count, size = s.size()
+	}
+
+	s.stats.setSpool(count, size, len(s.pending))
+
+	// warn each time the spool doubles in size
+	if size > 0 && size >= 2*s.warned {
+		log.Printf("spool growing: %d batches, %d bytes", count, size)
+		s.warned = size
+	}
+	if size == 0 {
+		s.warned = 0
+	}
+}
+
+// drain stores spooled batches, those in the spool directory first and then any held in memory,
+// stopping at the first failure.
+func (s *spool) drain(store func([]raw.Reading) error) error {
+	defer s.check()
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		readings, err := raw.ReadFile(f.path, raw.Csv{})
+		if err != nil {
+			return fmt.Errorf("unable to read spool file %s: %v", f.path, err)
+		}
+		if err := store(readings); err != nil {
+			return err
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+	}
+
+	for len(s.pending) > 0 {
+		if err := store(s.pending[0]); err != nil {
+			return err
+		}
+		s.pending = s.pending[1:]
+	}
+
+	return nil
+}
+
+// empty reports whether there is nothing waiting in the spool.
+func (s *spool) empty() bool {
+	n, _ := s.size()
+	return n == 0
+}
+
+func (s *spool) String() string {
+	if s.dir == "" {
+		return "memory"
+	}
+	return s.dir
+}
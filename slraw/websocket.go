@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// a minimal server side websocket (RFC 6455) implementation, sufficient for pushing text messages.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+// the largest client frame accepted, clients are only expected to send control frames
+const maxFramePayload = 1 << 16
+
+type websocket struct {
+	conn net.Conn
+	rd   *bufio.Reader
+
+	// optional limit on how long each frame may take to write
+	timeout time.Duration
+}
+
+func headerContains(h http.Header, key, value string) bool {
+	for _, v := range h.Values(key) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocket, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("not a websocket request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing websocket key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+
+	if _, err := fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &websocket{conn: conn, rd: rw.Reader}, nil
+}
+
+func (ws *websocket) writeFrame(op byte, payload []byte) error {
+	head := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xffff:
+		head = append(head, 126, 0, 0)
+		binary.BigEndian.PutUint16(head[2:], uint16(n))
+	default:
+		head = append(head, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(head[2:], uint64(n))
+	}
+	if ws.timeout > 0 {
+		if err := ws.conn.SetWriteDeadline(time.Now().Add(ws.timeout)); err != nil {
+			return err
+		}
+	}
+	if _, err := ws.conn.Write(append(head, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ws *websocket) readFrame() (byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(ws.rd, head); err != nil {
+		return 0, nil, err
+	}
+
+	op, masked, n := head[0]&0x0f, head[1]&0x80 != 0, uint64(head[1]&0x7f)
+	switch n {
+	case 126:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(ws.rd, b); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(ws.rd, b); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b)
+	}
+	if n > maxFramePayload {
+		return 0, nil, errors.New("websocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.rd, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(ws.rd, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return op, payload, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ozym/raw/seedlink"
+)
+
+func main() {
+
+	var listen string
+	flag.StringVar(&listen, "listen", ":18000", "seedlink listen address")
+	var pace float64
+	flag.Float64Var(&pace, "pace", 0.0, "replay speed relative to real time, zero for no delay")
+	var disconnects string
+	flag.StringVar(&disconnects, "disconnects", "", "comma separated packet counts after which successive connections are dropped")
+
+	flag.Parse()
+
+	server := seedlink.NewServer()
+	server.Pace = pace
+	server.Logf = log.Printf
+
+	for _, d := range strings.Split(disconnects, ",") {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			log.Fatalf("invalid disconnect count: %s", d)
+		}
+		server.Disconnects = append(server.Disconnects, n)
+	}
+
+	for _, infile := range flag.Args() {
+		log.Printf("reading: %s", infile)
+		if err := server.AddFile(infile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// handle process signals via the context
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("serving %d packets: %s", len(server.Packets()), listen)
+	if err := server.ListenAndServe(ctx, listen); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("terminated")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ozym/raw/seedlink"
+)
+
+// list collects repeated flag values.
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// split decodes an edit in the form "NET_STA=VALUE".
+func split(edit string) (string, string, string, error) {
+	parts := strings.SplitN(edit, "=", 2)
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("invalid edit, expected NET_STA=VALUE: %s", edit)
+	}
+	keys := strings.Split(parts[0], "_")
+	if len(keys) != 2 || keys[0] == "" || keys[1] == "" {
+		return "", "", "", fmt.Errorf("invalid stream, expected NET_STA: %s", parts[0])
+	}
+	return keys[0], keys[1], parts[1], nil
+}
+
+func main() {
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] statefile\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Inspect or edit a seedlink state file, legacy libslink files are converted when written.\n\n")
+		flag.PrintDefaults()
+	}
+
+	var asJSON bool
+	flag.BoolVar(&asJSON, "json", false, "print the state as json")
+	var legacy string
+	flag.StringVar(&legacy, "import", "", "merge entries from a legacy libslink state file")
+	var sequences list
+	flag.Var(&sequences, "sequence", "set a sequence number, as NET_STA=SEQ (repeatable)")
+	var times list
+	flag.Var(&times, "time", "set a last sample time, as NET_STA=RFC3339 (repeatable)")
+	var servers list
+	flag.Var(&servers, "server", "set the server which issued the sequence number, as NET_STA=HOST:PORT (repeatable)")
+	var deletes list
+	flag.Var(&deletes, "delete", "remove the entry for NET_STA (repeatable)")
+
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	statefile := flag.Arg(0)
+
+	var state seedlink.State
+	if _, err := os.Stat(statefile); err == nil {
+		if state, err = seedlink.ReadStateFile(statefile); err != nil {
+			log.Fatalf("unable to read state: %s: %v", statefile, err)
+		}
+	}
+
+	var changed bool
+
+	if legacy != "" {
+		f, err := os.Open(legacy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		imported, err := seedlink.DecodeLegacyState(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("unable to import state: %s: %v", legacy, err)
+		}
+		for _, ss := range imported.Streams {
+			state.Set(ss)
+		}
+		changed = true
+	}
+
+	edit := func(edits list, fn func(*seedlink.StreamState, string) error) {
+		for _, e := range edits {
+			net, sta, value, err := split(e)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ss, ok := state.Stream(net, sta)
+			if !ok {
+				ss = seedlink.StreamState{Network: net, Station: sta, Sequence: -1}
+			}
+			if err := fn(&ss, value); err != nil {
+				log.Fatalf("invalid edit: %s: %v", e, err)
+			}
+			state.Set(ss)
+			changed = true
+		}
+	}
+
+	edit(sequences, func(ss *seedlink.StreamState, value string) error {
+		seq, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		ss.Sequence = seq
+		return nil
+	})
+	edit(times, func(ss *seedlink.StreamState, value string) error {
+		at, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return err
+		}
+		at = at.UTC()
+		ss.Time = &at
+		return nil
+	})
+	edit(servers, func(ss *seedlink.StreamState, value string) error {
+		ss.Server = value
+		return nil
+	})
+
+	for _, d := range deletes {
+		keys := strings.Split(d, "_")
+		if len(keys) != 2 || !state.Delete(keys[0], keys[1]) {
+			log.Fatalf("no state entry found: %s", d)
+		}
+		changed = true
+	}
+
+	if changed {
+		if err := seedlink.WriteStateFile(statefile, state); err != nil {
+			log.Fatalf("unable to write state: %s: %v", statefile, err)
+		}
+	}
+
+	if asJSON {
+		if err := state.Encode(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STREAM\tSEQUENCE\tTIME\tSERVER")
+	for _, ss := range state.Streams {
+		var at string
+		if ss.Time != nil {
+			at = ss.Time.Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", ss.Key(), ss.Sequence, at, ss.Server)
+	}
+	tw.Flush()
+}
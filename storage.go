@@ -2,6 +2,7 @@ package raw
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -16,14 +17,29 @@ func Read(r io.Reader, rd Reader) ([]Reading, error) {
 	return rd.Read(r)
 }
 
+// ReadFile reads readings from a file, if no reader is given the format is detected from the
+// file extension or contents. Files ending in ".gz" or ".bz2" are decompressed.
 func ReadFile(path string, rd Reader) ([]Reading, error) {
-	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if rd == nil {
+		f, err := detectFile(path)
+		if err != nil {
+			return nil, err
+		}
+		rd = f.New(-1)
+	}
+
+	f, err := openFile(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	return rd.Read(f)
+	readings, err := rd.Read(f)
+	if perr, ok := err.(*ParseError); ok && perr.File == "" {
+		perr.File = path
+	}
+
+	return readings, err
 }
 
 type Writer interface {
@@ -34,6 +50,7 @@ func Write(w io.Writer, wr Writer, readings []Reading) error {
 	return wr.Write(w, readings)
 }
 
+// WriteFile atomically replaces a file with the given readings, files ending in ".gz" are compressed.
 func WriteFile(path string, wr Writer, readings []Reading) error {
 
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
@@ -47,7 +64,17 @@ func WriteFile(path string, wr Writer, readings []Reading) error {
 	}
 	defer os.Remove(f.Name())
 
-	if err := wr.Write(f, readings); err != nil {
+	z, err := compressWriter(path, f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := wr.Write(z, readings); err != nil {
+		f.Close()
+		return err
+	}
+	if err := z.Close(); err != nil {
+		f.Close()
 		return err
 	}
 	if err := f.Close(); err != nil {
@@ -65,53 +92,108 @@ type ReadWriter interface {
 	Writer
 }
 
+// RejectReader can read past malformed rows, returning the valid readings and the rows it skipped.
+type RejectReader interface {
+	ReadRejects(io.Reader) ([]Reading, []*ParseError, error)
+}
+
+// ReadWriteFile merges readings into any existing file, which is only rewritten if its contents change.
+// Use MergeFile to find out about any malformed rows dropped from the existing file.
 func ReadWriteFile(path string, rw ReadWriter, readings []Reading) error {
+	_, err := MergeFile(path, rw, readings)
+	return err
+}
+
+// MergeFile merges readings into any existing file, which is only rewritten if its contents change.
+// Existing files with malformed rows keep their valid readings if the codec can skip rows, and the
+// rows dropped from the rewritten file are returned. An existing file which can't be read is never
+// overwritten, the error is returned instead.
+func MergeFile(path string, rw ReadWriter, readings []Reading) ([]*ParseError, error) {
 	if _, err := os.Stat(path); err != nil {
-		return WriteFile(path, rw, readings)
+		return nil, WriteFile(path, rw, readings)
 	}
 
-	raw, err := ioutil.ReadFile(path)
+	raw, err := readAll(path)
 	if err != nil {
-		return WriteFile(path, rw, readings)
+		return nil, err
 	}
 
+	var rejects []*ParseError
+
 	existing, err := Read(bytes.NewBuffer(raw), rw)
 	if err != nil {
-		return WriteFile(path, rw, readings)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if perr.File == "" {
+			perr.File = path
+		}
+		lenient, ok := rw.(RejectReader)
+		if !ok {
+			return nil, perr
+		}
+		if existing, rejects, err = lenient.ReadRejects(bytes.NewBuffer(raw)); err != nil {
+			if perr, ok := err.(*ParseError); ok && perr.File == "" {
+				perr.File = path
+			}
+			return nil, err
+		}
+		for _, r := range rejects {
+			if r.File == "" {
+				r.File = path
+			}
+		}
 	}
 
 	obs := Merge(existing, readings)
 
 	var buf bytes.Buffer
 	if err := Write(&buf, rw, obs); err != nil {
-		return WriteFile(path, rw, readings)
+		return nil, err
 	}
 
 	if !bytes.Equal(raw, buf.Bytes()) {
-		return WriteFile(path, rw, readings)
+		return rejects, WriteFile(path, rw, obs)
 	}
 
-	return nil
+	return rejects, nil
+}
+
+// readAll returns the decompressed contents of a file.
+func readAll(path string) ([]byte, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
 }
 
-func Store(dir string, rw ReadWriter, filename func(Reading) (string, error), readings []Reading) error {
+// Store merges readings into the files named by the filename function, any malformed rows dropped
+// from existing files are returned.
+func Store(dir string, rw ReadWriter, filename func(Reading) (string, error), readings []Reading) ([]*ParseError, error) {
 
 	// map readings into files
 	files := make(map[string][]Reading)
 	for _, r := range readings {
 		n, err := filename(r)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		files[n] = append(files[n], r)
 	}
 
 	// update each file
+	var rejects []*ParseError
 	for k, rr := range files {
-		if err := ReadWriteFile(filepath.Join(dir, k), rw, rr); err != nil {
-			return err
+		dropped, err := MergeFile(filepath.Join(dir, k), rw, rr)
+		rejects = append(rejects, dropped...)
+		if err != nil {
+			return rejects, err
 		}
 	}
 
-	return nil
+	return rejects, nil
 }
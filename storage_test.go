@@ -0,0 +1,198 @@
+package raw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadWriteFile_Merge(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.csv")
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	first := []Reading{{"NZ_APIM_50_LFZ", at, 1.0}, {"NZ_APIM_50_LFZ", at.Add(time.Second), 2.0}}
+	second := []Reading{{"NZ_APIM_50_LFZ", at.Add(time.Second), 3.0}, {"NZ_APIM_50_LFZ", at.Add(2 * time.Second), 4.0}}
+
+	if err := ReadWriteFile(path, Csv{}, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadWriteFile(path, Csv{}, second); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ReadFile(path, Csv{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Reading{first[0], second[0], second[1]}
+	if len(r) != len(expected) {
+		t.Fatalf("invalid number of readings, expected %d found %d", len(expected), len(r))
+	}
+	for i := range expected {
+		if !r[i].Equal(expected[i]) || r[i].Value != expected[i].Value {
+			t.Errorf("invalid reading %d, expected %s found %s", i, expected[i], r[i])
+		}
+	}
+}
+
+func TestReadWriteFile_Compressed(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.csv.gz")
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	readings := []Reading{{"NZ_APIM_50_LFZ", at, 1.0}, {"NZ_APIM_50_LFZ", at.Add(time.Second), 2.0}}
+
+	if _, err := Store(dir, Csv{}, func(Reading) (string, error) { return "test.csv.gz", nil }, readings); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unchanged readings should leave the compressed file alone
+	time.Sleep(10 * time.Millisecond)
+	if err := ReadWriteFile(path, Csv{}, readings[:1]); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("unchanged compressed file was rewritten")
+	}
+
+	r, err := ReadFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != len(readings) {
+		t.Errorf("invalid number of readings, expected %d found %d", len(readings), len(r))
+	}
+
+	if err := WriteFile(filepath.Join(dir, "test.csv.bz2"), Csv{}, readings); err == nil {
+		t.Error("expected an error writing bzip2")
+	}
+}
+
+func TestReadWriteFile_Rejects(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.csv")
+
+	existing := "2016-08-02T04:00:00Z,NZ_APIM_50_LFZ,1\n2016-08-02T04:00:01Z,NZ_APIM_50_LFZ,x\n2016-08-02T04:00:02Z,NZ_APIM_50_LFZ,3\n"
+	if err := ioutil.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2016, time.August, 2, 4, 0, 3, 0, time.UTC)
+	rejects, err := MergeFile(path, Csv{}, []Reading{{"NZ_APIM_50_LFZ", at, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejects) != 1 || rejects[0].File != path || rejects[0].Line != 2 {
+		t.Errorf("invalid rejects, expected %s line 2 found %v", path, rejects)
+	}
+
+	r, err := ReadFile(path, Csv{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 3 {
+		t.Errorf("invalid number of readings, expected %d found %d", 3, len(r))
+	}
+
+	// codecs which can't skip rows should leave the file alone
+	strict := struct {
+		Reader
+		Writer
+	}{Csv{}, Csv{}}
+	if err := ioutil.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadWriteFile(path, strict, []Reading{{"NZ_APIM_50_LFZ", at, 4}}); err == nil {
+		t.Error("expected an error merging into a malformed file")
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != existing {
+		t.Errorf("malformed file was overwritten: %q", string(b))
+	}
+
+	// nor should files which can't be read at all
+	gz := filepath.Join(dir, "test.csv.gz")
+	if err := ioutil.WriteFile(gz, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadWriteFile(gz, Csv{}, []Reading{{"NZ_APIM_50_LFZ", at, 4}}); err == nil {
+		t.Error("expected an error merging into an unreadable file")
+	}
+	if b, _ := ioutil.ReadFile(gz); string(b) != existing {
+		t.Errorf("unreadable file was overwritten: %q", string(b))
+	}
+}
+
+func TestReadWriteFile_Codecs(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	// each codec keeps the good rows around a malformed one
+	for _, x := range []struct {
+		name     string
+		rw       ReadWriter
+		existing string
+		line     int
+		expected int
+	}{
+		{"test.jsonl", Jsonl{}, `{"source":"A","time":"2016-08-02T04:00:00Z","value":1}` + "\n{\n" + `{"source":"A","time":"2016-08-02T04:00:02Z","value":3}` + "\n", 2, 3},
+		{"test.wide.csv", Wide{}, "time,A,B\n2016-08-02T04:00:00Z,1,10\n2016-08-02T04:00:01Z,x,20\n2016-08-02T04:00:02Z,3,30\n", 3, 6},
+	} {
+		path := filepath.Join(dir, x.name)
+		if err := ioutil.WriteFile(path, []byte(x.existing), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		rejects, err := MergeFile(path, x.rw, []Reading{{"A", at.Add(3 * time.Second), 4}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rejects) != 1 || rejects[0].Line != x.line || rejects[0].File != path {
+			t.Errorf("%s: invalid rejects, expected line %d found %v", x.name, x.line, rejects)
+		}
+
+		r, err := ReadFile(path, x.rw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r) != x.expected {
+			t.Errorf("%s: invalid number of readings, expected %d found %d", x.name, x.expected, len(r))
+		}
+	}
+}
@@ -3,79 +3,408 @@ package raw
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 )
 
+// Template builds file names from readings, e.g.
+//
+//	{{Year .Epoch}}/{{Year .Epoch}}.{{Doy .Epoch}}/{{.Source}}.csv
+//
+// Stream functions take either a reading or a source name:
+//
+//	Network, Station, Location, Channel  NZ_APIM_50_LFZ -> NZ, APIM, 50, LFZ
+//	SeedID                               NZ_APIM_50_LFZ -> NZ.APIM.50.LFZ
+//	FDSN                                 NZ_APIM_50_LFZ -> FDSN:NZ_APIM_50_L_F_Z
+//	DataType                             NZ_APIM_50_LFZ -> magnetic (from the instrument code)
+//	Interval                             NZ_APIM_50_LFZ -> sec (from the band code)
+//
+// Time functions format a time:
+//
+//	Year, Month, Day, Doy, Hour, Minute, Second  2016-08-02T04:16:05Z -> 2016, 08, 02, 215, 04, 16, 05
+//	ISOYear, ISOWeek                             2016-01-02T00:00:00Z -> 2015, 53
+//	JulianDay                                    2016-08-02T04:16:05Z -> 2457603 (the Julian day number)
+//	Unix                                         2016-08-02T04:16:05Z -> 1470111365
+//
+// Bucket functions return a time for use with the time functions, e.g. for 10 minute files:
+//
+//	{{Minute (Minutes 10 .Epoch)}}   2016-08-02T04:16:05Z -> 10
+//	{{Hour (Hours 6 .Epoch)}}        2016-08-02T04:16:05Z -> 00
+//	{{Unix (Truncate "1h" .Epoch)}}  2016-08-02T04:16:05Z -> 1470110400
+//
+// String functions suit pipelines:
+//
+//	{{Upper .Source}}, {{Lower .Source}}, {{.Source | Replace "_" "-"}}
+//
+// Station metadata functions, Meta, IAGA, Observatory and TypeCode, need an inventory, see NewTemplateWith.
+//
+// Reading times are converted to the template location, UTC by default, before rendering. Rendered
+// names must stay within the base directory, and control characters or backslashes are replaced.
 type Template struct {
 	*template.Template
+
+	Location *time.Location
+}
+
+// julianUnixEpoch is the Julian day number of 1970-01-01.
+const julianUnixEpoch = 2440588
+
+// sourceName accepts either a reading or its source name.
+func sourceName(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case Reading:
+		return s.Source, nil
+	case *Reading:
+		return s.Source, nil
+	case string:
+		return s, nil
+	default:
+		return "", fmt.Errorf("expected a reading or a source name, found %T", v)
+	}
+}
+
+// sourcePart returns an underscore separated element of the source name.
+func sourcePart(n int) func(interface{}) (string, error) {
+	return func(v interface{}) (string, error) {
+		s, err := sourceName(v)
+		if err != nil {
+			return "", err
+		}
+		if parts := strings.Split(s, "_"); len(parts) > n {
+			return parts[n], nil
+		}
+		return "", nil
+	}
 }
 
+// channelCode returns a single character of the channel code, or zero if it is missing.
+func channelCode(v interface{}, n int) (byte, error) {
+	c, err := sourcePart(3)(v)
+	if err != nil || len(c) <= n {
+		return 0, err
+	}
+	return strings.ToUpper(c)[n], nil
+}
+
+// instruments labels the SEED instrument codes.
+var instruments = map[byte]string{
+	'A': "tilt",
+	'D': "pressure",
+	'E': "electronic",
+	'F': "magnetic",
+	'G': "gravity",
+	'H': "seismic",
+	'I': "humidity",
+	'K': "temperature",
+	'L': "seismic",
+	'M': "seismic",
+	'N': "acceleration",
+	'O': "current",
+	'Q': "electric",
+	'R': "rain",
+	'S': "strain",
+	'T': "tide",
+	'U': "bolometer",
+	'V': "volumetric",
+	'W': "wind",
+}
+
+// intervals labels the SEED band codes with IAGA style sampling intervals.
+var intervals = map[byte]string{
+	'L': "sec",
+	'V': "10sec",
+	'U': "min",
+	'R': "hor",
+	'P': "day",
+}
+
+// truncate floors a time in its own location, rather than relative to UTC.
+func truncate(t time.Time, d time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(d).Add(-shift)
+}
+
+func bucket(unit time.Duration) func(int, time.Time) (time.Time, error) {
+	return func(n int, t time.Time) (time.Time, error) {
+		if n < 1 {
+			return time.Time{}, fmt.Errorf("invalid bucket size: %d", n)
+		}
+		return truncate(t, time.Duration(n)*unit), nil
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	"Network":  sourcePart(0),
+	"Station":  sourcePart(1),
+	"Location": sourcePart(2),
+	"Channel":  sourcePart(3),
+	"SeedID": func(v interface{}) (string, error) {
+		s, err := sourceName(v)
+		if err != nil {
+			return "", err
+		}
+		return strings.Replace(s, "_", ".", -1), nil
+	},
+	"FDSN": func(v interface{}) (string, error) {
+		s, err := sourceName(v)
+		if err != nil {
+			return "", err
+		}
+		parts := strings.Split(s, "_")
+		for len(parts) < 4 {
+			parts = append(parts, "")
+		}
+		cha := parts[3]
+		if len(cha) == 3 {
+			cha = strings.Join([]string{cha[0:1], cha[1:2], cha[2:3]}, "_")
+		}
+		return "FDSN:" + strings.Join([]string{parts[0], parts[1], parts[2], cha}, "_"), nil
+	},
+	"DataType": func(v interface{}) (string, error) {
+		c, err := channelCode(v, 1)
+		if err != nil {
+			return "", err
+		}
+		if l, ok := instruments[c]; ok {
+			return l, nil
+		}
+		return "unknown", nil
+	},
+	"Interval": func(v interface{}) (string, error) {
+		c, err := channelCode(v, 0)
+		if err != nil {
+			return "", err
+		}
+		if l, ok := intervals[c]; ok {
+			return l, nil
+		}
+		return "unknown", nil
+	},
+	"Year": func(t time.Time) string {
+		return t.Format("2006")
+	},
+	"Month": func(t time.Time) string {
+		return t.Format("01")
+	},
+	"Day": func(t time.Time) string {
+		return t.Format("02")
+	},
+	"Doy": func(t time.Time) string {
+		return fmt.Sprintf("%03d", t.YearDay())
+	},
+	"Hour": func(t time.Time) string {
+		return t.Format("15")
+	},
+	"Minute": func(t time.Time) string {
+		return t.Format("04")
+	},
+	"Second": func(t time.Time) string {
+		return t.Format("05")
+	},
+	"ISOYear": func(t time.Time) string {
+		y, _ := t.ISOWeek()
+		return fmt.Sprintf("%04d", y)
+	},
+	"ISOWeek": func(t time.Time) string {
+		_, w := t.ISOWeek()
+		return fmt.Sprintf("%02d", w)
+	},
+	"JulianDay": func(t time.Time) string {
+		// use the calendar date in the time's own location
+		days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+		return strconv.FormatInt(days+julianUnixEpoch, 10)
+	},
+	"Unix": func(t time.Time) string {
+		return strconv.FormatInt(t.Unix(), 10)
+	},
+	"Minutes": bucket(time.Minute),
+	"Hours":   bucket(time.Hour),
+	"Truncate": func(d string, t time.Time) (time.Time, error) {
+		dur, err := time.ParseDuration(d)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if dur <= 0 {
+			return time.Time{}, fmt.Errorf("invalid truncation: %s", d)
+		}
+		return truncate(t, dur), nil
+	},
+	"Upper": strings.ToUpper,
+	"Lower": strings.ToLower,
+	"Replace": func(old, new, s string) string {
+		return strings.Replace(s, old, new, -1)
+	},
+}
+
+// templateSample is used to check new templates can be rendered.
+var templateSample = Reading{
+	Source: "NZ_APIM_50_LFZ",
+	Epoch:  time.Date(2016, time.August, 2, 4, 16, 5, 0, time.UTC),
+}
+
+// NewTemplate builds a template which renders times in UTC.
 func NewTemplate(tmpl string) (*Template, error) {
-	t, err := template.New("readings").Funcs(template.FuncMap{
-		"Network": func(r Reading) string {
-			if parts := strings.Split(r.Source, "_"); len(parts) > 0 {
-				return parts[0]
+	return NewTemplateIn(tmpl, time.UTC)
+}
+
+// NewTemplateIn builds a template which renders times in the given location, the template
+// is checked by rendering a sample reading.
+func NewTemplateIn(tmpl string, loc *time.Location) (*Template, error) {
+	return NewTemplateWith(tmpl, loc, nil)
+}
+
+// inventoryFuncs gives templates access to station metadata, readings from stations missing
+// from the inventory can't be rendered.
+func inventoryFuncs(inv *Inventory) template.FuncMap {
+	meta := func(v interface{}) (StationInfo, error) {
+		s, err := sourceName(v)
+		if err != nil {
+			return StationInfo{}, err
+		}
+		if inv == nil {
+			return StationInfo{}, fmt.Errorf("no station inventory given")
+		}
+		info, ok := inv.Lookup(s)
+		if !ok {
+			return StationInfo{}, fmt.Errorf("no station metadata for %s", s)
+		}
+		return info, nil
+	}
+
+	interval := templateFuncs["Interval"].(func(interface{}) (string, error))
+
+	return template.FuncMap{
+		"Meta": meta,
+		"IAGA": func(v interface{}) (string, error) {
+			info, err := meta(v)
+			if err != nil {
+				return "", err
 			}
-			return ""
-		},
-		"Station": func(r Reading) string {
-			if parts := strings.Split(r.Source, "_"); len(parts) > 1 {
-				return parts[1]
+			if info.IAGA == "" {
+				return "", fmt.Errorf("no iaga code for %s_%s", info.Network, info.Station)
 			}
-			return ""
+			return info.IAGA, nil
 		},
-		"Location": func(r Reading) string {
-			if parts := strings.Split(r.Source, "_"); len(parts) > 2 {
-				return parts[2]
+		"Observatory": func(v interface{}) (string, error) {
+			info, err := meta(v)
+			if err != nil {
+				return "", err
 			}
-			return ""
+			return info.Name, nil
 		},
-		"Channel": func(r Reading) string {
-			if parts := strings.Split(r.Source, "_"); len(parts) > 3 {
-				return parts[3]
+		"TypeCode": func(v interface{}) (string, error) {
+			info, err := meta(v)
+			if err != nil {
+				return "", err
 			}
-			return ""
-		},
-		"Year": func(t time.Time) string {
-			return t.Format("2006")
-		},
-		"Month": func(t time.Time) string {
-			return t.Format("01")
-		},
-		"Day": func(t time.Time) string {
-			return t.Format("02")
+			return info.TypeCode(), nil
 		},
-		"Doy": func(t time.Time) string {
-			return fmt.Sprintf("%03d", t.YearDay())
-		},
-		"Hour": func(t time.Time) string {
-			return t.Format("15")
-		},
-		"Minute": func(t time.Time) string {
-			return t.Format("04")
-		},
-		"Second": func(t time.Time) string {
-			return t.Format("05")
+		// any inventory interval is preferred to the channel band code
+		"Interval": func(v interface{}) (string, error) {
+			if s, err := sourceName(v); err == nil {
+				if info, ok := inv.Lookup(s); ok && info.Interval != "" {
+					return info.Interval, nil
+				}
+			}
+			return interval(v)
 		},
-	}).Parse(tmpl)
+	}
+}
+
+// NewTemplateWith builds a template which renders times in the given location and which can use
+// station metadata from an inventory, e.g. for INTERMAGNET style names:
+//
+//	{{Lower (IAGA .)}}{{Year .Epoch}}{{Month .Epoch}}{{Day .Epoch}}{{TypeCode .}}{{Interval .}}.{{Interval .}}
+//
+// The template is checked by rendering a sample reading, with the inventory given it must render for
+// at least one of its stations.
+func NewTemplateWith(tmpl string, loc *time.Location, inv *Inventory) (*Template, error) {
+	t, err := template.New("readings").Funcs(templateFuncs).Funcs(inventoryFuncs(inv)).Parse(tmpl)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Template{
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	res := &Template{
 		Template: t,
-	}, nil
+		Location: loc,
+	}
+
+	samples := []Reading{templateSample}
+	if inv != nil && len(inv.Stations) > 0 {
+		samples = nil
+		for _, s := range inv.Stations {
+			sample := templateSample
+			sample.Source = strings.Join([]string{s.Network, s.Station, "50", "LFZ"}, "_")
+			samples = append(samples, sample)
+		}
+	}
+
+	// stations may have partial metadata, so any one rendering is enough
+	var first error
+	for _, sample := range samples {
+		_, err := res.Execute(sample)
+		if err == nil {
+			return res, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+
+	return nil, fmt.Errorf("invalid template %q: %v", tmpl, first)
+}
+
+// cleanPath replaces control characters and backslashes, and rejects paths which are empty,
+// absolute, or which would escape the base directory.
+func cleanPath(name string) (string, error) {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	switch {
+	case strings.TrimSpace(name) == "":
+		return "", fmt.Errorf("empty file name")
+	case filepath.IsAbs(name), strings.HasPrefix(name, "/"):
+		return "", fmt.Errorf("absolute file name: %s", name)
+	}
+	for _, p := range strings.Split(name, "/") {
+		if p == ".." {
+			return "", fmt.Errorf("file name outside the base directory: %s", name)
+		}
+	}
+	if strings.HasSuffix(name, "/") {
+		return "", fmt.Errorf("file name is a directory: %s", name)
+	}
+
+	return filepath.Clean(name), nil
 }
 
 func (t Template) Execute(r Reading) (string, error) {
 	if t.Template == nil {
 		return "", fmt.Errorf("no template given")
 	}
+
+	loc := t.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	r.Epoch = r.Epoch.In(loc)
+
 	b := new(bytes.Buffer)
 	if err := t.Template.Execute(b, r); err != nil {
 		return "", err
 	}
-	return b.String(), nil
+
+	return cleanPath(b.String())
 }
@@ -0,0 +1,146 @@
+package raw
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplate_Funcs(t *testing.T) {
+
+	r := Reading{"NZ_APIM_50_LFZ", time.Date(2016, time.August, 2, 4, 16, 5, 500000000, time.UTC), 1.0}
+
+	var tests = []struct {
+		t string
+		s string
+	}{
+		{"{{Network .}}", "NZ"},
+		{"{{Station .}}", "APIM"},
+		{"{{Location .}}", "50"},
+		{"{{Channel .}}", "LFZ"},
+		{"{{Station .Source}}", "APIM"},
+		{"{{SeedID .}}", "NZ.APIM.50.LFZ"},
+		{"{{FDSN .Source}}", "FDSN:NZ_APIM_50_L_F_Z"},
+		{"{{DataType .}}", "magnetic"},
+		{"{{DataType \"NZ_APIM_50_LKO\"}}", "temperature"},
+		{"{{DataType \"NZ_APIM\"}}", "unknown"},
+		{"{{Interval .}}", "sec"},
+		{"{{Interval \"NZ_APIM_50_UFZ\"}}", "min"},
+		{"{{Year .Epoch}}", "2016"},
+		{"{{Month .Epoch}}", "08"},
+		{"{{Day .Epoch}}", "02"},
+		{"{{Doy .Epoch}}", "215"},
+		{"{{Hour .Epoch}}", "04"},
+		{"{{Minute .Epoch}}", "16"},
+		{"{{Second .Epoch}}", "05"},
+		{"{{ISOYear .Epoch}}.{{ISOWeek .Epoch}}", "2016.31"},
+		{"{{JulianDay .Epoch}}", "2457603"},
+		{"{{Unix .Epoch}}", "1470111365"},
+		{"{{Hour (Minutes 10 .Epoch)}}{{Minute (Minutes 10 .Epoch)}}", "0410"},
+		{"{{Hour (Hours 6 .Epoch)}}", "00"},
+		{"{{Unix (Truncate \"1h\" .Epoch)}}", "1470110400"},
+		{"{{Upper \"apim\"}}", "APIM"},
+		{"{{Lower .Source}}", "nz_apim_50_lfz"},
+		{"{{.Source | Replace \"_\" \"-\"}}", "NZ-APIM-50-LFZ"},
+	}
+
+	for _, x := range tests {
+		tmpl, err := NewTemplate(x.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := tmpl.Execute(r)
+		if err != nil {
+			t.Fatalf("unable to execute %s: %v", x.t, err)
+		}
+		if s != x.s {
+			t.Errorf("invalid template output for %s, expected %q found %q", x.t, x.s, s)
+		}
+	}
+}
+
+func TestTemplate_ISOWeek(t *testing.T) {
+	tmpl, err := NewTemplate("{{ISOYear .Epoch}}-W{{ISOWeek .Epoch}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := tmpl.Execute(Reading{Epoch: time.Date(2016, time.January, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "2015-W53" {
+		t.Errorf("invalid iso week, expected %q found %q", "2015-W53", s)
+	}
+}
+
+func TestTemplate_Errors(t *testing.T) {
+	for _, x := range []string{"{{Minutes 0 .Epoch}}", "{{Truncate \"soon\" .Epoch}}", "{{Station .Epoch}}", "{{.Missing}}", "../{{.Source}}", "/tmp/{{.Source}}", ""} {
+		if _, err := NewTemplate(x); err == nil {
+			t.Errorf("expected an error building template %q", x)
+		}
+	}
+}
+
+func TestTemplate_Paths(t *testing.T) {
+	tmpl, err := NewTemplate("{{Year .Epoch}}/{{.Source}}.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2016, time.August, 2, 4, 16, 5, 0, time.UTC)
+
+	var tests = []struct {
+		s string
+		p string
+	}{
+		{"NZ_APIM_50_LFZ", "2016/NZ_APIM_50_LFZ.csv"},
+		{"NZ\\APIM\x00", "2016/NZ_APIM_.csv"},
+		{"./NZ_APIM", "2016/NZ_APIM.csv"},
+		{"../../etc/passwd", ""},
+		{"a/../../../b", ""},
+	}
+
+	for _, x := range tests {
+		p, err := tmpl.Execute(Reading{Source: x.s, Epoch: at})
+		switch {
+		case x.p == "" && err == nil:
+			t.Errorf("expected an error rendering %q, found %q", x.s, p)
+		case x.p != "" && err != nil:
+			t.Errorf("unable to render %q: %v", x.s, err)
+		case p != x.p:
+			t.Errorf("invalid path for %q, expected %q found %q", x.s, x.p, p)
+		}
+	}
+}
+
+func TestTemplate_Zone(t *testing.T) {
+
+	// the same instant given in different locations
+	utc := time.Date(2016, time.August, 2, 14, 30, 0, 0, time.UTC)
+	local := utc.In(time.FixedZone("NZST", 12*60*60))
+
+	tmpl, err := NewTemplate("{{Year .Epoch}}.{{Doy .Epoch}}.{{Hour .Epoch}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []time.Time{utc, local} {
+		s, err := tmpl.Execute(Reading{Source: "NZ_APIM_50_LFZ", Epoch: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != "2016.215.14" {
+			t.Errorf("invalid utc rendering of %s, expected %q found %q", at, "2016.215.14", s)
+		}
+	}
+
+	zoned, err := NewTemplateIn("{{Year .Epoch}}.{{Doy .Epoch}}.{{Hour (Hours 6 .Epoch)}}.{{JulianDay .Epoch}}", time.FixedZone("NZST", 12*60*60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := zoned.Execute(Reading{Source: "NZ_APIM_50_LFZ", Epoch: utc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "2016.216.00.2457604" {
+		t.Errorf("invalid zoned rendering, expected %q found %q", "2016.216.00.2457604", s)
+	}
+}
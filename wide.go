@@ -0,0 +1,216 @@
+package raw
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const wideTimeColumn = "time"
+
+func init() {
+	RegisterFormat(Format{
+		Name:       "wide",
+		Extensions: []string{".csv"},
+		New: func(dp int) ReadWriter {
+			return NewWide(dp, 0)
+		},
+		Sniff: sniffWide,
+	})
+}
+
+// sniffWide checks for a time header followed by source names, rather than csv column names,
+// and that any complete second line is a matching data row.
+func sniffWide(head []byte) bool {
+	lines := strings.SplitAfter(string(head), "\n")
+
+	header, err := csv.NewReader(strings.NewReader(lines[0])).Read()
+	if err != nil || len(header) < 2 || header[0] != wideTimeColumn {
+		return false
+	}
+	for _, h := range header[1:] {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "", "epoch", CsvTime, CsvSource, CsvValue:
+			return false
+		}
+	}
+
+	// the head may end part way through the second line
+	if len(lines) < 3 {
+		return true
+	}
+	row, err := csv.NewReader(strings.NewReader(lines[1])).Read()
+	if err != nil || len(row) != len(header) {
+		return false
+	}
+	var t time.Time
+	return t.UnmarshalText([]byte(row[0])) == nil
+}
+
+// Wide reads and writes csv files with one row per epoch and one column per source, the
+// header row holds the source names and missing samples are left blank.
+type Wide struct {
+	DecimalPlace *int
+
+	// optional per stream formatting, streams without a matching rule use the decimal places
+	Precision PrecisionRules
+
+	// readings are aligned to the nearest multiple of the tolerance, zero requires exact epochs
+	Tolerance time.Duration
+}
+
+func NewWide(dp int, tolerance time.Duration) *Wide {
+	return &Wide{
+		DecimalPlace: &dp,
+		Tolerance:    tolerance,
+	}
+}
+
+func (w Wide) align(t time.Time) time.Time {
+	if w.Tolerance <= 0 {
+		return t
+	}
+	return t.Round(w.Tolerance)
+}
+
+func (w Wide) Write(wr io.Writer, rr []Reading) error {
+	var sources []string
+	var precisions []Precision
+	index := make(map[string]int)
+	for _, r := range Sort(rr) {
+		if _, ok := index[r.Source]; !ok {
+			index[r.Source], sources = len(sources), append(sources, r.Source)
+			precisions = append(precisions, w.Precision.Select(r.Source, w.DecimalPlace))
+		}
+	}
+
+	// later readings replace earlier ones aligned to the same epoch
+	rows := make(map[time.Time][]string)
+	for _, r := range Sort(rr) {
+		t := w.align(r.Epoch)
+		row, ok := rows[t]
+		if !ok {
+			row = make([]string, len(sources)+1)
+			b, err := t.MarshalText()
+			if err != nil {
+				return err
+			}
+			row[0], rows[t] = string(b), row
+		}
+		if !math.IsNaN(r.Value) {
+			i := index[r.Source]
+			row[i+1] = precisions[i].Format(r.Value)
+		}
+	}
+
+	var epochs []time.Time
+	for t := range rows {
+		epochs = append(epochs, t)
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i].Before(epochs[j]) })
+
+	data := [][]string{append([]string{wideTimeColumn}, sources...)}
+	for _, t := range epochs {
+		data = append(data, rows[t])
+	}
+
+	return csv.NewWriter(wr).WriteAll(data)
+}
+
+func (w Wide) Read(rd io.Reader) ([]Reading, error) {
+	readings, _, err := w.read(rd, false)
+	return readings, err
+}
+
+// ReadRejects reads leniently, returning the valid readings together with any rows or samples which
+// could not be parsed, a file without the wide header is still an error.
+func (w Wide) ReadRejects(rd io.Reader) ([]Reading, []*ParseError, error) {
+	return w.read(rd, true)
+}
+
+func (w Wide) read(rd io.Reader, lenient bool) ([]Reading, []*ParseError, error) {
+	var readings []Reading
+	var rejects []*ParseError
+
+	r := csv.NewReader(rd)
+	r.FieldsPerRecord = -1
+
+	// malformed rows or samples either stop the read or are collected
+	fail := func(record []string, field int, err error) error {
+		line, column := r.FieldPos(field)
+		perr := &ParseError{Line: line, Column: column, Record: record, Err: err}
+		if !lenient {
+			return perr
+		}
+		rejects = append(rejects, perr)
+		return nil
+	}
+
+	var sources []string
+	for {
+		d, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var cerr *csv.ParseError
+			if !errors.As(err, &cerr) {
+				return nil, nil, err
+			}
+			perr := &ParseError{Line: cerr.Line, Column: cerr.Column, Record: d, Err: cerr.Err}
+			if !lenient || sources == nil {
+				return nil, nil, perr
+			}
+			rejects = append(rejects, perr)
+			continue
+		}
+
+		if sources == nil {
+			if len(d) < 1 || d[0] != wideTimeColumn {
+				line, column := r.FieldPos(0)
+				return nil, nil, &ParseError{Line: line, Column: column, Record: d, Err: fmt.Errorf("missing wide csv header")}
+			}
+			sources = d[1:]
+			continue
+		}
+		if len(d) != len(sources)+1 {
+			if err := fail(d, 0, fmt.Errorf("invalid sample element length: %d", len(d))); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		var t time.Time
+		if err := t.UnmarshalText([]byte(d[0])); err != nil {
+			if err := fail(d, 0, fmt.Errorf("invalid sample time: %v", err)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		for i, s := range d[1:] {
+			if s == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				if err := fail(d, i+1, fmt.Errorf("invalid sample float: %v", err)); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			readings = append(readings, Reading{
+				Source: sources[i],
+				Epoch:  t,
+				Value:  v,
+			})
+		}
+	}
+
+	return readings, rejects, nil
+}
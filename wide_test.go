@@ -0,0 +1,172 @@
+package raw
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWide_Write(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LFX", at.Add(20 * time.Millisecond), 18076.6},
+		{"NZ_APIM_50_LFZ", at, -41221},
+		{"NZ_APIM_50_LFX", at.Add(time.Second), 18076.7},
+		{"NZ_APIM_50_LKO", at.Add(time.Second - 30*time.Millisecond), 12.5},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, NewWide(-1, time.Second), readings); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `time,NZ_APIM_50_LFX,NZ_APIM_50_LFZ,NZ_APIM_50_LKO
+2016-08-02T04:00:00Z,18076.6,-41221,
+2016-08-02T04:00:01Z,18076.7,,12.5
+`
+	if buf.String() != expected {
+		t.Errorf("invalid wide output, expected:\n%s\nfound:\n%s", expected, buf.String())
+	}
+
+	r, err := Read(bytes.NewBufferString(buf.String()), Wide{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != len(readings) {
+		t.Fatalf("invalid number of readings, expected %d found %d", len(readings), len(r))
+	}
+	for _, x := range r {
+		if !x.Epoch.Equal(x.Epoch.Round(time.Second)) {
+			t.Errorf("reading not aligned: %s", x)
+		}
+	}
+
+	if f, err := DetectFormat("test.csv", buf.Bytes()); err != nil || f.Name != "wide" {
+		t.Errorf("unable to detect wide csv: %v", err)
+	}
+}
+
+func TestWide_Precision(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	readings := []Reading{
+		{"NZ_APIM_50_LFZ", at, -41221.256},
+		{"NZ_APIM_50_LKO", at, 12.3456},
+		{"NZ_APIM_50_LKO", at.Add(time.Second), 12.35},
+	}
+
+	rules, err := ParsePrecisionRules("NZ_*_*_LK?=fixed:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Wide{Precision: rules}, readings); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `time,NZ_APIM_50_LFZ,NZ_APIM_50_LKO
+2016-08-02T04:00:00Z,-41221.256,12.3
+2016-08-02T04:00:01Z,,12.3
+`
+	if buf.String() != expected {
+		t.Errorf("invalid wide output, expected:\n%s\nfound:\n%s", expected, buf.String())
+	}
+}
+
+func TestWide_ReadWriteFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.csv")
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+
+	first := []Reading{{"A", at, 1}, {"B", at.Add(10 * time.Millisecond), 2}}
+	second := []Reading{{"B", at.Add(time.Second), 3}}
+
+	for _, rr := range [][]Reading{first, second, first} {
+		if err := ReadWriteFile(path, NewWide(-1, time.Second), rr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := ReadFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 3 {
+		t.Errorf("invalid number of readings, expected %d found %d", 3, len(r))
+	}
+}
+
+func TestWide_Sniff(t *testing.T) {
+
+	at := time.Date(2016, time.August, 2, 4, 0, 0, 0, time.UTC)
+	readings := []Reading{{"NZ_APIM_50_LFZ", at, 1}, {"NZ_APIM_50_LFZ", at.Add(time.Second), 2}}
+
+	var tests = []struct {
+		rw ReadWriter
+		n  string
+	}{
+		{NewWide(-1, 0), "wide"},
+		{Csv{}, "csv"},
+		{Csv{Dialect: CsvDialect{Header: true}}, "csv"},
+		{Csv{Dialect: CsvDialect{Header: true, Columns: []string{CsvTime, "flag", CsvValue}, Source: "NZ_APIM_50_LFZ"}}, "csv"},
+	}
+
+	for _, x := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, x.rw, readings); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := DetectFormat("test.csv", buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name != x.n {
+			t.Errorf("invalid format sniffed for %q, expected %s found %s", buf.String(), x.n, f.Name)
+		}
+	}
+}
+
+func TestWide_Rejects(t *testing.T) {
+
+	s := "time,A,B\n2016-08-02T04:00:00Z,1,2\n2016-08-02T04:00:01Z,x,3\nyesterday,4,5\n2016-08-02T04:00:03Z,6\n2016-08-02T04:00:04Z,7,8\n"
+
+	_, err := Read(bytes.NewBufferString(s), Wide{})
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected a parse error, found %v", err)
+	}
+	if perr.Line != 3 || perr.Column != 22 {
+		t.Errorf("invalid parse error position, expected line 3, column 22 found %v", perr)
+	}
+
+	r, rejects, err := Wide{}.ReadRejects(bytes.NewBufferString(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 5 {
+		t.Errorf("invalid number of readings, expected %d found %d", 5, len(r))
+	}
+	if len(rejects) != 3 {
+		t.Errorf("invalid number of rejects, expected %d found %d", 3, len(rejects))
+	}
+
+	// the header is needed to know the sources
+	if _, _, err := (Wide{}).ReadRejects(bytes.NewBufferString("2016-08-02T04:00:00Z,1,2\n")); err == nil {
+		t.Error("expected an error without a header")
+	}
+}